@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	opGet  = "get"
+	opSet  = "set"
+	opLock = "lock"
+	opStop = "stop"
+)
+
+var (
+	// SocketPath agent 监听的 Unix socket 路径
+	SocketPath = filepath.Join(os.Getenv("HOME"), ".sshe", "agent.sock")
+	// ErrNotRunning agent 未运行
+	ErrNotRunning = errors.New("sshe agent is not running")
+)
+
+// 请求
+type request struct {
+	Op  string `json:"op"`
+	Key string `json:"key,omitempty"`
+}
+
+// 响应
+type response struct {
+	Key   string `json:"key,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// 缓存的密钥状态
+type state struct {
+	mu          sync.Mutex
+	key         []byte
+	idleTimeout time.Duration
+	timer       *time.Timer
+}
+
+// 清除缓存的密钥
+func (s *state) lock() {
+	for i := range s.key {
+		s.key[i] = 0
+	}
+	s.key = nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// 重置空闲计时器
+func (s *state) touch() {
+	if s.idleTimeout <= 0 || s.key == nil {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(s.idleTimeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// 计时器已被重置时忽略
+		if s.timer == timer {
+			s.lock()
+		}
+	})
+	s.timer = timer
+}
+
+// Serve 在前台运行 agent，空闲超过 idleTimeout 后清除密钥，收到 stop 请求后退出
+func Serve(idleTimeout time.Duration) error {
+	// 已有 agent 运行时拒绝启动，否则清理残留的 socket 文件
+	if conn, err := net.Dial("unix", SocketPath); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("an agent is already listening on %s", SocketPath)
+	}
+	_ = os.Remove(SocketPath)
+
+	listener, err := net.Listen("unix", SocketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", SocketPath, err)
+	}
+	defer func() {
+		_ = listener.Close()
+		_ = os.Remove(SocketPath)
+	}()
+	if err := os.Chmod(SocketPath, 0600); err != nil {
+		return fmt.Errorf("failed to set socket permission: %v", err)
+	}
+
+	s := &state{idleTimeout: idleTimeout}
+	stop := make(chan struct{})
+	go func() {
+		<-stop
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-stop:
+				s.mu.Lock()
+				s.lock()
+				s.mu.Unlock()
+				return nil
+			default:
+				return fmt.Errorf("failed to accept connection: %v", err)
+			}
+		}
+		if handle(conn, s) {
+			close(stop)
+		}
+	}
+}
+
+// 处理单个请求，返回是否需要退出
+func handle(conn net.Conn, s *state) bool {
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		_ = json.NewEncoder(conn).Encode(response{Error: "invalid request"})
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp response
+	switch req.Op {
+	case opGet:
+		if s.key != nil {
+			resp.Key = base64.StdEncoding.EncodeToString(s.key)
+			s.touch()
+		}
+	case opSet:
+		key, err := base64.StdEncoding.DecodeString(req.Key)
+		if err != nil || len(key) == 0 {
+			resp.Error = "invalid key"
+			break
+		}
+		s.lock()
+		s.key = key
+		s.touch()
+	case opLock:
+		s.lock()
+	case opStop:
+		_ = json.NewEncoder(conn).Encode(resp)
+		return true
+	default:
+		resp.Error = "unknown operation " + req.Op
+	}
+
+	_ = json.NewEncoder(conn).Encode(resp)
+	return false
+}
+
+// 向 agent 发送请求
+func call(req request) (response, error) {
+	conn, err := net.DialTimeout("unix", SocketPath, time.Second)
+	if err != nil {
+		return response{}, ErrNotRunning
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return response{}, fmt.Errorf("failed to send request to agent: %v", err)
+	}
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return response{}, fmt.Errorf("failed to read response from agent: %v", err)
+	}
+	if resp.Error != "" {
+		return response{}, fmt.Errorf("agent error: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// GetKey 获取 agent 缓存的密钥，agent 已锁定时返回 nil
+func GetKey() ([]byte, error) {
+	resp, err := call(request{Op: opGet})
+	if err != nil || resp.Key == "" {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(resp.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key from agent: %v", err)
+	}
+	return key, nil
+}
+
+// SetKey 将密钥缓存到 agent
+func SetKey(key []byte) error {
+	_, err := call(request{Op: opSet, Key: base64.StdEncoding.EncodeToString(key)})
+	return err
+}
+
+// Lock 清除 agent 缓存的密钥
+func Lock() error {
+	_, err := call(request{Op: opLock})
+	return err
+}
+
+// Stop 停止 agent
+func Stop() error {
+	_, err := call(request{Op: opStop})
+	return err
+}
@@ -1,36 +1,75 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
+	"net"
+	"os"
+	"path/filepath"
 	"sshe/config"
 	"sshe/utils"
 	"strings"
 )
 
+var (
+	keyPath       string
+	importKeyPath string
+	alias         string
+	jumps         []string
+	nodeProxy     string
+)
+
 // add 命令
 var addCmd = &cobra.Command{
-	Use:   "add <IP>",
+	Use:   "add <host[:port]>",
 	Short: "Add node connection information.",
+	Long:  `Add node connection information. The address can be an IP or a hostname, optionally followed by a port, e.g. 10.0.0.1, example.com:2222, [2001:db8::1]:2222.`,
 	Args:  cobra.ExactArgs(1),
 	RunE:  runAddCommand,
 }
 
 func runAddCommand(cmd *cobra.Command, args []string) error {
 	cmd.SilenceUsage = true
-	ip := args[0]
+	address := args[0]
+
+	// 检查地址合法性
+	host, port, err := utils.ParseHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if port == config.DefaultPort {
+		port = 0
+	}
+	if err := assertHostKeyPolicyValid(hostKeyPolicyFlag); err != nil {
+		return err
+	}
+	if err := assertAliasValid(alias); err != nil {
+		return err
+	}
+	if _, err := parseForwards(localForwards, remoteForwards, dynamicForwards); err != nil {
+		return err
+	}
+	for _, jump := range jumps {
+		if _, ok := config.FindNode(jump); !ok {
+			return fmt.Errorf("jump node %s was not found", jump)
+		}
+	}
 
-	// 检查 IP 地址合法性
-	if err := utils.AssertIpAddressValid(ip); err != nil {
-		return fmt.Errorf("invalid IP address: %w", err)
+	node := config.Node{Port: port}
+	if net.ParseIP(host) != nil {
+		node.IP = host
+	} else {
+		node.Host = host
 	}
 
 	// 查询现有记录
-	existUsernames := getExistingUsernames(ip)
+	existUsernames := getExistingUsernames(node)
 
 	// 获取用户名
-	username, err := getUsername(existUsernames, ip)
+	username, err := getUsername(existUsernames, node.HostPort())
 	if err != nil {
 		return err
 	}
@@ -41,19 +80,52 @@ func runAddCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// 获取密码
-	password, err := getPassword()
+	// 获取私钥
+	privateKey, passphrase, err := getPrivateKey()
 	if err != nil {
 		return err
 	}
 
-	// 加密密码并添加节点
-	cipherText, err := utils.EncryptAES(password, config.GlobalConfig.SecretKey)
+	// 获取密码，配置了私钥时可以跳过
+	hasKey := keyPath != "" || importKeyPath != ""
+	password, err := getPassword(hasKey)
 	if err != nil {
+		return err
+	}
+
+	// 加密密码和私钥并添加节点
+	if node.Password, err = encryptSecret(password); err != nil {
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
+	if node.PrivateKey, err = encryptSecret(privateKey); err != nil {
+		return fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	if node.Passphrase, err = encryptSecret(passphrase); err != nil {
+		return fmt.Errorf("failed to encrypt key passphrase: %w", err)
+	}
+	if nodeProxy != "" {
+		if node.Proxy, err = parseProxyInput(nodeProxy); err != nil {
+			return err
+		}
+	}
+	if keyPath != "" {
+		node.KeyPath, err = filepath.Abs(expandHome(keyPath))
+		if err != nil {
+			return fmt.Errorf("failed to resolve key path: %w", err)
+		}
+	}
 
-	if err := config.AddNode(ip, username, cipherText, tags); err != nil {
+	node.Alias = alias
+	node.Jump = jumps
+	node.LocalForwards = localForwards
+	node.RemoteForwards = remoteForwards
+	node.DynamicForwards = dynamicForwards
+	node.Username = username
+	node.Tags = tags
+	node.HostKeyPolicy = hostKeyPolicyFlag
+	node.ForwardAgent = forwardAgentFlag
+	node.KeepaliveInterval = keepaliveFlag
+	if err := config.AddNode(node); err != nil {
 		return fmt.Errorf("failed to add node: %w", err)
 	}
 
@@ -61,11 +133,27 @@ func runAddCommand(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// 查询现有用户名
-func getExistingUsernames(ip string) []string {
+// 检查别名是否合法且未被使用
+func assertAliasValid(alias string) error {
+	if alias == "" {
+		return nil
+	}
+	if strings.ContainsAny(alias, "@:/ ") {
+		return fmt.Errorf("invalid alias %s, it cannot contain '@', ':', '/' or spaces", alias)
+	}
+	for _, node := range config.GlobalNode.Nodes {
+		if node.Alias == alias {
+			return fmt.Errorf("the alias %s is already used by %s", alias, node.ID())
+		}
+	}
+	return nil
+}
+
+// 查询同一地址和端口下现有的用户名
+func getExistingUsernames(target config.Node) []string {
 	var existUsernames []string
 	for _, node := range config.GlobalNode.Nodes {
-		if node.IP == ip {
+		if node.Address() == target.Address() && node.SSHPort() == target.SSHPort() {
 			existUsernames = append(existUsernames, node.Username)
 		}
 	}
@@ -73,18 +161,18 @@ func getExistingUsernames(ip string) []string {
 }
 
 // 获取用户名
-func getUsername(existUsernames []string, ip string) (string, error) {
+func getUsername(existUsernames []string, address string) (string, error) {
 	if user != "" {
 		for _, existUser := range existUsernames {
 			if existUser == user {
-				return "", fmt.Errorf("the username %s already exists for IP %s", user, ip)
+				return "", fmt.Errorf("the username %s already exists for %s", user, address)
 			}
 		}
 		return user, nil
 	}
 
 	if len(existUsernames) > 0 {
-		fmt.Printf("\nThe IP-recorded usernames are: %s.", strings.Join(existUsernames, ", "))
+		fmt.Printf("\nThe recorded usernames of %s are: %s.", address, strings.Join(existUsernames, ", "))
 	}
 	fmt.Print("\nInput username (default: root): ")
 
@@ -99,7 +187,7 @@ func getUsername(existUsernames []string, ip string) (string, error) {
 
 	for _, existUser := range existUsernames {
 		if existUser == inputUser {
-			return "", fmt.Errorf("the username %s already exists for IP %s", inputUser, ip)
+			return "", fmt.Errorf("the username %s already exists for %s", inputUser, address)
 		}
 	}
 	return inputUser, nil
@@ -129,8 +217,12 @@ func handleTagsInput(existingTags []string) ([]string, error) {
 }
 
 // 获取密码
-func getPassword() ([]byte, error) {
-	fmt.Print("\nInput password: ")
+func getPassword(optional bool) ([]byte, error) {
+	if optional {
+		fmt.Print("\nInput password (enter to skip): ")
+	} else {
+		fmt.Print("\nInput password: ")
+	}
 	password, err := term.ReadPassword(0)
 	if err != nil {
 		return nil, fmt.Errorf("error reading password: %w", err)
@@ -140,9 +232,65 @@ func getPassword() ([]byte, error) {
 	return password, nil
 }
 
+// 获取私钥，--import-key 时返回私钥内容，私钥有口令时提示输入口令
+func getPrivateKey() ([]byte, []byte, error) {
+	if keyPath != "" && importKeyPath != "" {
+		return nil, nil, errors.New("--key and --import-key cannot be used together")
+	}
+	path := keyPath
+	if importKeyPath != "" {
+		path = importKeyPath
+	}
+	if path == "" {
+		return nil, nil, nil
+	}
+
+	pemBytes, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	// 检查私钥是否合法
+	var passphrase []byte
+	_, err = ssh.ParsePrivateKey(pemBytes)
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) {
+		fmt.Print("\nInput key passphrase (enter to be prompted on every connection): ")
+		passphrase, err = term.ReadPassword(0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading passphrase: %w", err)
+		}
+		fmt.Println()
+		if len(passphrase) > 0 {
+			_, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, passphrase)
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key %s: %w", path, err)
+	}
+
+	if importKeyPath == "" {
+		return nil, passphrase, nil
+	}
+	return pemBytes, passphrase, nil
+}
+
 func init() {
 	rootCmd.AddCommand(addCmd)
 
 	addCmd.Flags().StringVarP(&user, "user", "u", "", "Specifies the username for connection.")
 	addCmd.Flags().StringArrayVarP(&tags, "tag", "t", []string{}, "Specify the tags for connection. Multiple tags are supported.")
+	addCmd.Flags().StringVarP(&alias, "alias", "a", "", "Specify an alias for the node.")
+	addCmd.Flags().StringArrayVarP(&jumps, "jump", "J", []string{}, "Connect through the given stored node (address@user or alias). Repeat to build a chain.")
+	addCmd.Flags().StringVarP(&nodeProxy, "proxy", "", "", "Connect through this proxy (socks5:// or http://), or \"direct\" to bypass the global proxy.")
+	addCmd.Flags().StringArrayVarP(&localForwards, "local-forward", "L", []string{}, "Save a local forward set up on every link: [bind:]port:host:hostport.")
+	addCmd.Flags().StringArrayVarP(&remoteForwards, "remote-forward", "R", []string{}, "Save a remote forward set up on every link: [bind:]port:host:hostport.")
+	addCmd.Flags().StringArrayVarP(&dynamicForwards, "dynamic-forward", "D", []string{}, "Save a SOCKS5 dynamic forward set up on every link: [bind:]port.")
+	addCmd.Flags().StringVarP(&keyPath, "key", "", "", "Authenticate with the private key file at this path.")
+	addCmd.Flags().StringVarP(&importKeyPath, "import-key", "", "", "Import the private key file into the vault (stored encrypted).")
+	addCmd.Flags().BoolVarP(&forwardAgentFlag, "forward-agent", "A", false, "Enable ssh-agent forwarding by default when linking to the node.")
+	addCmd.Flags().IntVarP(&keepaliveFlag, "keepalive", "", 0, "Keepalive interval in seconds when linking to the node, -1 disables (default: global setting).")
+	addCmd.Flags().StringVarP(&hostKeyPolicyFlag, "host-key-policy", "", "", "Host key policy of the node: strict, tofu or insecure (default: global setting).")
 }
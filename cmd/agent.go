@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sshe/agent"
+	"syscall"
+	"time"
+)
+
+var (
+	agentTimeout    time.Duration
+	agentForeground bool
+)
+
+// agent 命令
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Start an agent that caches the unlocked vault key.",
+	Long: `Start a background agent that keeps the key derived from the master password in memory and serves it over a Unix socket (` + agent.SocketPath + `).
+add/get/link ask the agent before prompting for the master password. The cached key is cleared after the idle timeout.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		if agentForeground {
+			// 收到退出信号时清理 socket
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				_ = agent.Stop()
+			}()
+			return agent.Serve(agentTimeout)
+		}
+
+		// 以后台进程方式重新启动自身
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate executable: %w", err)
+		}
+		daemon := exec.Command(executable, "agent", "--foreground", "--timeout", agentTimeout.String())
+		daemon.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		if err := daemon.Start(); err != nil {
+			return fmt.Errorf("failed to start agent: %w", err)
+		}
+
+		// 等待 socket 就绪
+		for i := 0; i < 50; i++ {
+			if _, err := agent.GetKey(); !errors.Is(err, agent.ErrNotRunning) {
+				fmt.Printf("Agent started (pid %d), listening on %s\n", daemon.Process.Pid, agent.SocketPath)
+				return daemon.Process.Release()
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return errors.New("agent did not start in time")
+	},
+}
+
+// agent lock 命令
+var agentLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Clear the key cached by the agent.",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		if err := agent.Lock(); err != nil {
+			return err
+		}
+		fmt.Println("Agent locked.")
+		return nil
+	},
+}
+
+// agent stop 命令
+var agentStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the agent.",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		if err := agent.Stop(); err != nil {
+			return err
+		}
+		fmt.Println("Agent stopped.")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+	agentCmd.AddCommand(agentLockCmd)
+	agentCmd.AddCommand(agentStopCmd)
+
+	agentCmd.Flags().DurationVarP(&agentTimeout, "timeout", "", 15*time.Minute, "Clear the cached key after being idle for this long, 0 means never.")
+	agentCmd.Flags().BoolVarP(&agentForeground, "foreground", "f", false, "Run the agent in the foreground.")
+}
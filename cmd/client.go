@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+	"path/filepath"
+	"sshe/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// 本地 ssh-agent 客户端
+	sshAgentClient agent.ExtendedAgent
+	sshAgentOnce   sync.Once
+
+	// 串行化并发连接时的交互提示，包括首次连接的主机密钥确认和私钥口令
+	promptMu sync.Mutex
+	// 本次执行中输入口令后解析的私钥，按私钥内容索引，多个节点使用同一私钥时只提示一次
+	promptedSigners = make(map[[sha256.Size]byte]ssh.Signer)
+)
+
+// 连接到节点并完成认证，配置了跳板节点时依次经过跳板节点连接
+func dialNode(node config.Node) (*ssh.Client, error) {
+	return dialNodeVia(node, map[string]bool{})
+}
+
+// 递归建立跳板链路，visited 用于检测循环引用
+func dialNodeVia(node config.Node, visited map[string]bool) (*ssh.Client, error) {
+	if visited[node.ID()] {
+		return nil, fmt.Errorf("jump chain of %s contains a loop", node.ID())
+	}
+	visited[node.ID()] = true
+
+	if len(node.Jump) == 0 {
+		return dialDirect(node)
+	}
+
+	// 第一个跳板节点按其自身的配置连接
+	hops, err := resolveJumpNodes(node.Jump)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialNodeVia(hops[0], visited)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to jump node %s: %w", hops[0].ID(), err)
+	}
+
+	// 后续跳板节点和目标节点通过上一跳的 direct-tcpip 通道连接
+	for _, hop := range append(hops[1:], node) {
+		next, err := dialThrough(client, hop)
+		if err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+		client = next
+	}
+	return client, nil
+}
+
+// 解析跳板节点引用
+func resolveJumpNodes(refs []string) ([]config.Node, error) {
+	var hops []config.Node
+	for _, ref := range refs {
+		hop, ok := config.FindNode(ref)
+		if !ok {
+			return nil, fmt.Errorf("jump node %s was not found", ref)
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// 直接或通过代理连接到节点
+func dialDirect(node config.Node) (*ssh.Client, error) {
+	clientConfig, err := newClientConfig(node)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := proxyDialer(node)
+	if err != nil {
+		return nil, err
+	}
+	if dialer != nil {
+		client, err := dialProxy(dialer, node.Endpoint(), clientConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to SSH server: %w", err)
+		}
+		return client, nil
+	}
+
+	client, err := ssh.Dial("tcp", node.Endpoint(), clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+	return client, nil
+}
+
+// 通过上一跳的客户端连接到节点，节点连接断开时关闭上一跳
+func dialThrough(prev *ssh.Client, node config.Node) (*ssh.Client, error) {
+	clientConfig, err := newClientConfig(node)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := prev.Dial("tcp", node.Endpoint())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel to %s: %w", node.ID(), err)
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, node.Endpoint(), clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to connect to SSH server %s: %w", node.ID(), err)
+	}
+
+	client := ssh.NewClient(clientConn, chans, reqs)
+	go func() {
+		_ = client.Wait()
+		_ = prev.Close()
+	}()
+	return client, nil
+}
+
+// 创建节点的 SSH 客户端配置
+func newClientConfig(node config.Node) (*ssh.ClientConfig, error) {
+	auth, err := authMethods(node)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig := &ssh.ClientConfig{
+		User:    node.Username,
+		Auth:    auth,
+		Timeout: 10 * time.Second,
+	}
+
+	// 校验主机密钥
+	if err := setupHostKeyCheck(clientConfig, node, node.Endpoint()); err != nil {
+		return nil, err
+	}
+	return clientConfig, nil
+}
+
+// 构造节点的认证方式，依次尝试节点私钥、ssh-agent 中的密钥和密码
+func authMethods(node config.Node) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	signer, err := nodeSigner(node)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一种认证方式只会尝试一次，节点私钥和 agent 中的密钥需要合并提供
+	var signers []ssh.Signer
+	if signer != nil {
+		signers = append(signers, signer)
+	}
+	// 只有节点没有配置密码和私钥时才使用 agent 中的密钥，agent 中密钥较多时
+	// 逐个尝试会超过服务端的 MaxAuthTries，导致配置的密码没有机会尝试
+	var agentClient agent.ExtendedAgent
+	if signer == nil && node.Password == "" {
+		agentClient = sshAgent()
+	}
+	if len(signers) > 0 || agentClient != nil {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			if agentClient == nil {
+				return signers, nil
+			}
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				return signers, nil
+			}
+			return append(signers, agentSigners...), nil
+		}))
+	}
+
+	if node.Password != "" {
+		password, err := decryptSecret(node.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt password: %w", err)
+		}
+		methods = append(methods, ssh.Password(password))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("node %s has no password or private key configured and no ssh-agent is available", node.ID())
+	}
+	return methods, nil
+}
+
+// 连接本地 ssh-agent，未设置 SSH_AUTH_SOCK 或连接失败时返回 nil
+func sshAgent() agent.ExtendedAgent {
+	sshAgentOnce.Do(func() {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return
+		}
+		sshAgentClient = agent.NewClient(conn)
+	})
+	return sshAgentClient
+}
+
+// 为会话开启 agent 转发
+func forwardAgent(client *ssh.Client, session *ssh.Session) error {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return errors.New("agent forwarding requested but SSH_AUTH_SOCK is not set")
+	}
+	if err := agent.ForwardToRemote(client, socket); err != nil {
+		return fmt.Errorf("failed to forward agent: %w", err)
+	}
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		return fmt.Errorf("failed to request agent forwarding: %w", err)
+	}
+	return nil
+}
+
+// 加载节点的私钥，未配置私钥时返回 nil
+func nodeSigner(node config.Node) (ssh.Signer, error) {
+	var pemBytes []byte
+	switch {
+	case node.PrivateKey != "":
+		privateKey, err := decryptSecret(node.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		pemBytes = []byte(privateKey)
+	case node.KeyPath != "":
+		data, err := os.ReadFile(expandHome(node.KeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		pemBytes = data
+	default:
+		return nil, nil
+	}
+
+	var passphrase []byte
+	if node.Passphrase != "" {
+		plainText, err := decryptSecret(node.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt key passphrase: %w", err)
+		}
+		passphrase = []byte(plainText)
+	}
+
+	return parsePrivateKey(pemBytes, passphrase, node.KeyPath)
+}
+
+// 解析私钥，私钥有口令且未提供时提示输入
+func parsePrivateKey(pemBytes, passphrase []byte, name string) (ssh.Signer, error) {
+	if passphrase != nil {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(pemBytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return signer, nil
+	}
+
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	var missingErr *ssh.PassphraseMissingError
+	if !errors.As(err, &missingErr) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return signer, nil
+	}
+
+	// 并发连接时只有一个协程提示输入，其他协程等待后直接使用解析好的私钥
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	sum := sha256.Sum256(pemBytes)
+	if signer, ok := promptedSigners[sum]; ok {
+		return signer, nil
+	}
+
+	if name == "" {
+		name = "imported key"
+	}
+	input, err := readSecret(fmt.Sprintf("Enter passphrase for %s: ", name))
+	if err != nil {
+		return nil, err
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	promptedSigners[sum] = signer
+	return signer, nil
+}
+
+// 展开路径开头的 ~
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	return path
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	recursive bool // 是否递归复制目录
+	preserve  bool // 是否保留修改时间
+	quiet     bool // 是否隐藏传输进度
+)
+
+// cp 命令
+var cpCmd = &cobra.Command{
+	Use:   "cp <source...> <target>",
+	Short: "Copy files between the local machine and a node over SFTP.",
+	Long: `Copy files between the local machine and a node over SFTP. Remote paths are written as <node>:<path>, where <node> is an alias, a node id or host[:port], e.g.
+  sshe cp ./app.conf web1:/etc/app/
+  sshe cp -r 10.0.0.1:2222:/var/log/app ./logs`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		sources, target := args[:len(args)-1], args[len(args)-1]
+		opts := transferOptions{recursive: recursive, preserve: preserve, progress: progressOutput(quiet)}
+
+		// 目标为远程路径时上传，否则下载
+		if ref, remotePath, ok := parseRemoteArg(target); ok {
+			for _, source := range sources {
+				if _, _, ok := parseRemoteArg(source); ok {
+					return errors.New("copying between two remote paths is not supported")
+				}
+			}
+			return uploadTo(ref, remotePath, sources, opts)
+		}
+
+		var ref string
+		var remotePaths []string
+		for _, source := range sources {
+			sourceRef, remotePath, ok := parseRemoteArg(source)
+			if !ok {
+				return errors.New("either the sources or the target must be a remote path <node>:<path>")
+			}
+			if ref != "" && sourceRef != ref {
+				return errors.New("all remote sources must be on the same node")
+			}
+			ref = sourceRef
+			remotePaths = append(remotePaths, remotePath)
+		}
+		return downloadFrom(ref, remotePaths, target, opts)
+	},
+}
+
+// 解析 <node>:<path> 格式的远程路径，节点部分取第一个 / 之前的最后一个冒号之前的内容
+func parseRemoteArg(arg string) (string, string, bool) {
+	head := arg
+	if i := strings.Index(arg, "/"); i >= 0 {
+		head = arg[:i]
+	}
+	i := strings.LastIndex(head, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	ref, remotePath := arg[:i], arg[i+1:]
+	// 不带端口的 IPv6 地址需要使用方括号
+	if strings.HasPrefix(ref, "[") && strings.HasSuffix(ref, "]") {
+		ref = ref[1 : len(ref)-1]
+	}
+	if remotePath == "" {
+		remotePath = "."
+	}
+	return ref, remotePath, true
+}
+
+// 上传本地文件到节点
+func uploadTo(ref, remotePath string, sources []string, opts transferOptions) error {
+	node, err := resolveNode(ref)
+	if err != nil {
+		return err
+	}
+	client, sftpClient, err := openSFTP(node)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = sftpClient.Close()
+		_ = client.Close()
+	}()
+
+	// 目标是已存在的目录时复制到目录下
+	targetIsDir := isRemoteDir(sftpClient, remotePath)
+	if len(sources) > 1 && !targetIsDir {
+		return fmt.Errorf("%s is not a directory", remotePath)
+	}
+	for _, source := range sources {
+		dest := remotePath
+		if targetIsDir {
+			dest = path.Join(remotePath, filepath.Base(source))
+		}
+		if err := upload(sftpClient, source, dest, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 从节点下载文件到本地
+func downloadFrom(ref string, remotePaths []string, localPath string, opts transferOptions) error {
+	node, err := resolveNode(ref)
+	if err != nil {
+		return err
+	}
+	client, sftpClient, err := openSFTP(node)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = sftpClient.Close()
+		_ = client.Close()
+	}()
+
+	// 目标是已存在的目录时复制到目录下
+	targetIsDir := isLocalDir(localPath)
+	if len(remotePaths) > 1 && !targetIsDir {
+		return fmt.Errorf("%s is not a directory", localPath)
+	}
+	for _, remotePath := range remotePaths {
+		dest := localPath
+		if targetIsDir {
+			dest = filepath.Join(localPath, path.Base(remotePath))
+		}
+		if err := download(sftpClient, remotePath, dest, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+
+	cpCmd.Flags().StringVarP(&user, "user", "u", "", "Specifies the username for connection.")
+	cpCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Copy directories recursively.")
+	cpCmd.Flags().BoolVarP(&preserve, "preserve", "p", false, "Preserve modification times.")
+	cpCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Do not show the progress.")
+	cpCmd.Flags().StringVarP(&hostKeyPolicyFlag, "host-key-policy", "", "", "Override the host key policy: strict, tofu or insecure.")
+}
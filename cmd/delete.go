@@ -4,34 +4,28 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"sshe/config"
-	"sshe/utils"
 )
 
 // delete 命令
 var deleteCmd = &cobra.Command{
-	Use:   "delete <IP>",
+	Use:   "delete <host[:port]>",
 	Short: "Delete a matching node.",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
-		ip := args[0]
-
-		// 检查 IP 地址合法性
-		if err := utils.AssertIpAddressValid(ip); err != nil {
-			return fmt.Errorf("invalid IP address: %w", err)
-		}
+		address := args[0]
 
 		// 获取节点信息
-		nodes, err := config.GetNode(ip, user)
+		nodes, err := findNodes(address)
 		if err != nil {
-			return fmt.Errorf("failed to retrieve nodes: %w", err)
+			return err
 		}
 		if len(nodes) == 0 {
-			return fmt.Errorf("no data matching IP %s was found, deletion is not needed", ip)
+			return fmt.Errorf("no data matching %s was found, deletion is not needed", address)
 		}
 
 		// 选择节点
-		node, err := selectNode(ip, nodes)
+		node, err := selectNode(address, nodes)
 		if err != nil {
 			return err
 		}
@@ -51,7 +45,7 @@ func confirmAndDeleteNode(node config.Node) error {
 	_ = printNodeInfo(node, false)
 
 	// 询问确认删除
-	fmt.Printf("\nAre you sure to delete the node with IP %s and username %s? [y/N]: ", node.IP, node.Username)
+	fmt.Printf("\nAre you sure to delete the node %s with username %s? [y/N]: ", node.HostPort(), node.Username)
 	var sureToDelete string
 	_, err := fmt.Scanln(&sureToDelete)
 	if err != nil && err.Error() != "unexpected newline" {
@@ -64,10 +58,10 @@ func confirmAndDeleteNode(node config.Node) error {
 	}
 
 	// 删除节点
-	if err := config.DeleteNode(node.IP, node.Username); err != nil {
+	if err := config.DeleteNode(node.Address(), node.SSHPort(), node.Username); err != nil {
 		return fmt.Errorf("failed to delete node: %w", err)
 	}
-	fmt.Printf("Node with IP %s and username %s has been deleted successfully.\n", node.IP, node.Username)
+	fmt.Printf("Node %s with username %s has been deleted successfully.\n", node.HostPort(), node.Username)
 	return nil
 }
 
@@ -0,0 +1,373 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"sshe/config"
+	"sshe/utils"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	editPassword bool     // 是否重新输入密码
+	addTags      []string // 添加的标签
+	removeTags   []string // 删除的标签
+	setUser      string   // 新的用户名
+	useEditor    bool     // 是否在编辑器中编辑
+)
+
+// 编辑器中节点文件的说明
+const editHeader = `# Edit the node and save to apply, secrets are shown decrypted and encrypted again on save.
+# Close the editor without changes to cancel.
+`
+
+// edit 命令
+var editCmd = &cobra.Command{
+	Use:   "edit <host[:port]>",
+	Short: "Modify a matching node.",
+	Long: `Modify a matching node in place. Use --password, --add-tag, --remove-tag and --set-user for common changes,
+or --editor to open the node as YAML in $VISUAL or $EDITOR with its secrets decrypted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		address := args[0]
+
+		flagEdit := editPassword || len(addTags) > 0 || len(removeTags) > 0 || setUser != ""
+		if !flagEdit && !useEditor {
+			return errors.New("nothing to edit, use --password, --add-tag, --remove-tag, --set-user or --editor")
+		}
+		if flagEdit && useEditor {
+			return errors.New("--editor cannot be used together with other edit flags")
+		}
+
+		// 查找并选择节点
+		node, err := resolveNode(address)
+		if err != nil {
+			return err
+		}
+
+		if useEditor {
+			err = editNodeInEditor(node)
+		} else {
+			err = editNodeWithFlags(node)
+		}
+		if err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+// 按命令行参数修改节点
+func editNodeWithFlags(node config.Node) error {
+	if setUser != "" {
+		if err := assertUsernameValid(setUser); err != nil {
+			return err
+		}
+	}
+
+	var password string
+	if editPassword {
+		// 配置了私钥时可以清空密码
+		plainText, err := getPassword(node.KeyPath != "" || node.PrivateKey != "")
+		if err != nil {
+			return err
+		}
+		if password, err = encryptSecret(plainText); err != nil {
+			return fmt.Errorf("failed to encrypt password: %w", err)
+		}
+	}
+
+	var updated config.Node
+	err := config.UpdateNode(node.ID(), func(n *config.Node) error {
+		if editPassword {
+			n.Password = password
+		}
+		if setUser != "" {
+			n.Username = setUser
+		}
+		for _, tag := range addTags {
+			tag = strings.TrimPrefix(tag, "#")
+			if tag != "" && !slices.Contains(n.Tags, tag) {
+				n.Tags = append(n.Tags, tag)
+			}
+		}
+		for _, tag := range removeTags {
+			n.Tags = slices.DeleteFunc(n.Tags, func(t string) bool {
+				return t == strings.TrimPrefix(tag, "#")
+			})
+		}
+		updated = *n
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to edit node: %w", err)
+	}
+
+	fmt.Printf("Node %s has been updated successfully.\n", updated.ID())
+	return nil
+}
+
+// 在编辑器中修改解密后的节点，保存后重新加密
+func editNodeInEditor(node config.Node) error {
+	plain, err := decryptNode(node)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(plain)
+	if err != nil {
+		return fmt.Errorf("failed to encode node: %w", err)
+	}
+	original := append([]byte(editHeader), data...)
+
+	// 临时文件包含明文密码，放在仅当前用户可访问的配置目录中，权限为 0600，任何情况下退出都会删除
+	dir := config.ConfigDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, ".edit-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := file.Name()
+	var editing atomic.Bool
+	stopWatch := removeOnSignal(tmpPath, &editing)
+	defer func() {
+		stopWatch()
+		_ = os.Remove(tmpPath)
+	}()
+	_, err = file.Write(original)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	for {
+		editing.Store(true)
+		err := runEditor(tmpPath)
+		editing.Store(false)
+		if err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to read temp file: %w", err)
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Println("No changes made.")
+			return nil
+		}
+
+		updated, err := parseEditedNode(edited, node)
+		if err == nil {
+			err = config.UpdateNode(node.ID(), func(n *config.Node) error {
+				*n = updated
+				return nil
+			})
+		}
+		if err == nil {
+			fmt.Printf("Node %s has been updated successfully.\n", updated.ID())
+			return nil
+		}
+
+		// 修改有误时可以重新编辑，避免丢失已做的修改
+		fmt.Printf("Invalid node: %v\nEdit again? [Y/n]: ", err)
+		var answer string
+		_, scanErr := fmt.Scanln(&answer)
+		if scanErr != nil && scanErr.Error() != "unexpected newline" {
+			return fmt.Errorf("failed to edit node: %w", err)
+		}
+		if answer != "" && !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return fmt.Errorf("failed to edit node: %w", err)
+		}
+	}
+}
+
+// 收到退出信号时删除文件并退出，编辑器运行时 Ctrl-C 交给编辑器处理，返回停止监听的函数
+func removeOnSignal(path string, editing *atomic.Bool) func() {
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if sig == syscall.SIGINT && editing.Load() {
+					continue
+				}
+				_ = os.Remove(path)
+				os.Exit(128 + int(sig.(syscall.Signal)))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
+
+// 解析并校验编辑后的节点，加密其中的敏感字段
+func parseEditedNode(data []byte, original config.Node) (config.Node, error) {
+	var node config.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&node); err != nil {
+		return config.Node{}, err
+	}
+
+	if err := assertNodeAddressValid(node); err != nil {
+		return config.Node{}, err
+	}
+	if err := assertUsernameValid(node.Username); err != nil {
+		return config.Node{}, err
+	}
+	if node.Alias != original.Alias {
+		if err := assertAliasValid(node.Alias); err != nil {
+			return config.Node{}, err
+		}
+	}
+	if err := assertHostKeyPolicyValid(node.HostKeyPolicy); err != nil {
+		return config.Node{}, err
+	}
+	if _, err := parseForwards(node.LocalForwards, node.RemoteForwards, node.DynamicForwards); err != nil {
+		return config.Node{}, err
+	}
+	if node.Proxy != nil && node.Proxy.URL != config.ProxyDirect {
+		proxyURL, err := utils.ParseProxyURL(node.Proxy.URL)
+		if err != nil {
+			return config.Node{}, err
+		}
+		if _, ok := proxyURL.User.Password(); ok {
+			return config.Node{}, errors.New("put the proxy password in proxy.password instead of the proxy URL")
+		}
+	}
+	for _, jump := range node.Jump {
+		if jump == original.ID() || jump == node.ID() || (node.Alias != "" && jump == node.Alias) {
+			return config.Node{}, errors.New("a node cannot jump through itself")
+		}
+		if _, ok := config.FindNode(jump); !ok {
+			return config.Node{}, fmt.Errorf("jump node %s was not found", jump)
+		}
+	}
+	if node.Port == config.DefaultPort {
+		node.Port = 0
+	}
+
+	if err := encryptNode(&node); err != nil {
+		return config.Node{}, err
+	}
+	return node, nil
+}
+
+// 检查节点地址和端口是否合法，与 add 命令的规则一致
+func assertNodeAddressValid(node config.Node) error {
+	switch {
+	case node.IP != "" && node.Host != "":
+		return errors.New("only one of ip and host can be set")
+	case node.IP != "":
+		if net.ParseIP(node.IP) == nil {
+			return fmt.Errorf("%s is an invalid IP address, use host for hostnames", node.IP)
+		}
+	case node.Host != "":
+		if net.ParseIP(node.Host) != nil {
+			return fmt.Errorf("%s is an IP address, use ip instead of host", node.Host)
+		}
+		if err := utils.AssertHostValid(node.Host); err != nil {
+			return err
+		}
+	default:
+		return errors.New("ip or host is required")
+	}
+	if node.Port < 0 || node.Port > 65535 {
+		return fmt.Errorf("%d is an invalid port", node.Port)
+	}
+	return nil
+}
+
+// 检查用户名是否合法
+func assertUsernameValid(username string) error {
+	if username == "" {
+		return errors.New("username is required")
+	}
+	if strings.ContainsAny(username, "@ ") {
+		return fmt.Errorf("invalid username %s, it cannot contain '@' or spaces", username)
+	}
+	return nil
+}
+
+// 返回解密了所有敏感字段的节点副本
+func decryptNode(node config.Node) (config.Node, error) {
+	if node.Proxy != nil {
+		proxy := *node.Proxy
+		node.Proxy = &proxy
+	}
+	for _, field := range node.SecretFields() {
+		if *field.Value == "" {
+			continue
+		}
+		plainText, err := decryptSecret(*field.Value)
+		if err != nil {
+			return config.Node{}, fmt.Errorf("failed to decrypt %s: %w", field.Name, err)
+		}
+		*field.Value = plainText
+	}
+	return node, nil
+}
+
+// 加密节点中的所有敏感字段
+func encryptNode(node *config.Node) error {
+	for _, field := range node.SecretFields() {
+		cipherText, err := encryptSecret([]byte(*field.Value))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", field.Name, err)
+		}
+		*field.Value = cipherText
+	}
+	return nil
+}
+
+// 打开编辑器，依次使用 $VISUAL、$EDITOR 和 vi
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// 通过 shell 执行，支持 "code --wait" 这类带参数的编辑器
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+
+	editCmd.Flags().StringVarP(&user, "user", "u", "", "Specifies the username for connection.")
+	editCmd.Flags().BoolVarP(&editPassword, "password", "", false, "Prompt for a new password.")
+	editCmd.Flags().StringArrayVarP(&addTags, "add-tag", "", []string{}, "Add a tag to the node. Repeat to add several tags.")
+	editCmd.Flags().StringArrayVarP(&removeTags, "remove-tag", "", []string{}, "Remove a tag from the node. Repeat to remove several tags.")
+	editCmd.Flags().StringVarP(&setUser, "set-user", "", "", "Change the username of the node.")
+	editCmd.Flags().BoolVarP(&useEditor, "editor", "e", false, "Edit the node as YAML in $VISUAL or $EDITOR with its secrets decrypted.")
+}
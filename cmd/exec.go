@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"sshe/config"
+	"strings"
+)
+
+// 是否为远程命令分配伪终端
+var execTTY bool
+
+// exec 命令
+var execCmd = &cobra.Command{
+	Use:   "exec <host[:port]> -- <command...>",
+	Short: "Run a command on a matching node.",
+	Long:  `Run a command on a matching node non-interactively. Stdin, stdout and stderr are connected to the remote command and sshe exits with the remote exit status.`,
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		address := args[0]
+
+		// 查找并选择节点
+		node, err := resolveNode(address)
+		if err != nil {
+			return err
+		}
+
+		err = sshExec(node, strings.Join(args[1:], " "))
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			// 远程命令的错误输出已经显示，不再重复打印
+			cmd.SilenceErrors = true
+		}
+		return err
+	},
+}
+
+// 在节点上执行命令，远程命令以非零状态退出时返回 exitCodeError
+func sshExec(node config.Node, command string) error {
+	client, err := dialNode(node)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	// 开启 agent 转发
+	if forwardAgentFlag || node.ForwardAgent {
+		if err := forwardAgent(client, session); err != nil {
+			return err
+		}
+	}
+
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	session.Stdin = os.Stdin
+
+	if execTTY {
+		restore, err := requestTerminal(session)
+		if err != nil {
+			return err
+		}
+		defer restore()
+		defer watchTerminalSignals(session, nil)()
+	}
+
+	err = session.Run(command)
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return &exitCodeError{code: exitErr.ExitStatus()}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run command: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().StringVarP(&user, "user", "u", "", "Specifies the username for connection.")
+	execCmd.Flags().BoolVarP(&execTTY, "tty", "t", false, "Allocate a pseudo terminal for the command.")
+	execCmd.Flags().BoolVarP(&forwardAgentFlag, "forward-agent", "A", false, "Enable forwarding of the local ssh-agent to the node.")
+	execCmd.Flags().StringVarP(&hostKeyPolicyFlag, "host-key-policy", "", "", "Override the host key policy: strict, tofu or insecure.")
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"os"
+	"sshe/config"
+	"sshe/utils"
+)
+
+var (
+	// 命令行参数指定的端口转发
+	localForwards   []string
+	remoteForwards  []string
+	dynamicForwards []string
+)
+
+// 端口转发，关闭时停止所有监听
+type forwarder struct {
+	client    *ssh.Client
+	listeners []net.Listener
+	logf      func(format string, args ...interface{})
+}
+
+// 端口转发规则
+type forwardRule struct {
+	kind   string // local、remote 或 dynamic
+	listen string
+	target string
+}
+
+// 在 raw 模式的终端中输出日志，需要显式回车
+func terminalLogf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\r\n", args...)
+}
+
+// 解析转发参数，返回校验后的转发规则
+func parseForwards(local, remote, dynamic []string) ([]forwardRule, error) {
+	var rules []forwardRule
+	for _, spec := range local {
+		listen, target, err := utils.ParseForwardSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, forwardRule{kind: "local", listen: listen, target: target})
+	}
+	for _, spec := range remote {
+		listen, target, err := utils.ParseForwardSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, forwardRule{kind: "remote", listen: listen, target: target})
+	}
+	for _, spec := range dynamic {
+		listen, err := utils.ParseDynamicForwardSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, forwardRule{kind: "dynamic", listen: listen})
+	}
+	return rules, nil
+}
+
+// 合并节点保存的转发和命令行参数指定的转发
+func nodeForwards(node config.Node) ([]forwardRule, error) {
+	return parseForwards(
+		append(append([]string{}, node.LocalForwards...), localForwards...),
+		append(append([]string{}, node.RemoteForwards...), remoteForwards...),
+		append(append([]string{}, node.DynamicForwards...), dynamicForwards...),
+	)
+}
+
+// 在客户端上建立所有转发规则，任一规则失败时关闭已建立的转发
+func startForwards(client *ssh.Client, rules []forwardRule, logf func(format string, args ...interface{})) (*forwarder, error) {
+	f := &forwarder{client: client, logf: logf}
+	for _, rule := range rules {
+		if err := f.start(rule); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// 建立一条转发规则
+func (f *forwarder) start(rule forwardRule) error {
+	switch rule.kind {
+	case "remote":
+		// 在远程节点上监听，连接转发到本地的目标地址
+		listener, err := f.client.Listen("tcp", rule.listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on remote %s: %w", rule.listen, err)
+		}
+		f.listeners = append(f.listeners, listener)
+		f.logf("Remote forward %s -> %s", listener.Addr(), rule.target)
+		go f.serve(listener, func(conn net.Conn) (net.Conn, error) {
+			return net.Dial("tcp", rule.target)
+		})
+	case "dynamic":
+		// 在本地提供 SOCKS5 代理，连接通过远程节点发出
+		listener, err := net.Listen("tcp", rule.listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", rule.listen, err)
+		}
+		f.listeners = append(f.listeners, listener)
+		f.logf("Dynamic forward (SOCKS5) on %s", listener.Addr())
+		go f.serve(listener, func(conn net.Conn) (net.Conn, error) {
+			return utils.SOCKS5Handshake(conn, f.client.Dial)
+		})
+	default:
+		// 在本地监听，连接通过远程节点转发到目标地址
+		listener, err := net.Listen("tcp", rule.listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", rule.listen, err)
+		}
+		f.listeners = append(f.listeners, listener)
+		f.logf("Local forward %s -> %s", listener.Addr(), rule.target)
+		go f.serve(listener, func(conn net.Conn) (net.Conn, error) {
+			return f.client.Dial("tcp", rule.target)
+		})
+	}
+	return nil
+}
+
+// 接受监听上的连接，通过 dial 连接目标后双向转发
+func (f *forwarder) serve(listener net.Listener, dial func(conn net.Conn) (net.Conn, error)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			target, err := dial(conn)
+			if err != nil {
+				f.logf("Forward from %s failed: %v", conn.RemoteAddr(), err)
+				_ = conn.Close()
+				return
+			}
+			utils.Pipe(conn, target)
+		}()
+	}
+}
+
+// Close 停止所有转发监听，已建立的连接随 SSH 连接关闭
+func (f *forwarder) Close() {
+	for _, listener := range f.listeners {
+		_ = listener.Close()
+	}
+	f.listeners = nil
+}
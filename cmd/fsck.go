@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"slices"
+	"sort"
+	"sshe/config"
+	"sshe/utils"
+)
+
+// 是否修复发现的问题
+var repair bool
+
+// fsck 命令
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check node.yaml for inconsistencies and optionally repair them.",
+	Long: `Check node.yaml for inconsistencies: tag_index entries that do not match the nodes' tags, duplicate node ids and aliases, and secrets that cannot be decrypted with the current key.
+With --repair the file is backed up to node.yaml.fsck.<time>.bak, later duplicates are removed, undecryptable secrets are cleared and tag_index is regenerated (or dropped unless write_tag_index is set).`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		key, err := unlockLegacyVault()
+		if err != nil {
+			return err
+		}
+
+		// 没有校验值时无法确认密钥是否正确，密钥错误时所有字段都无法解密，不能据此清空
+		if repair && config.GlobalNode.Verifier == "" && !canDecryptAll(config.GlobalNode, key) {
+			return errors.New("some secrets cannot be decrypted and the key cannot be checked against the vault, " +
+				"make sure secret_key in sshe.conf is correct, nothing was changed")
+		}
+
+		// 先在副本上检查，不修改原数据
+		problems, err := checkTagIndex()
+		if err != nil {
+			return err
+		}
+		nodes := config.GlobalNode.Clone()
+		problems = append(problems, fixNodes(&nodes, key)...)
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) == 0 {
+			fmt.Println("No problems found.")
+			return nil
+		}
+
+		if !repair {
+			fmt.Printf("%d problems found, run sshe fsck --repair to fix them.\n", len(problems))
+			cmd.SilenceErrors = true
+			return &exitCodeError{code: 1}
+		}
+
+		// 在锁内基于最新的数据修复，标签索引随写回重新生成
+		var backupPath string
+		err = config.UpdateNodes(func(nodes *config.NodesFile) error {
+			var err error
+			backupPath, err = config.BackupNodesFile("fsck")
+			if err != nil {
+				return err
+			}
+			fixNodes(nodes, key)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to repair nodes file: %w", err)
+		}
+		fmt.Printf("Repaired %d problems, backup saved to %s\n", len(problems), backupPath)
+		return nil
+	},
+}
+
+// 对比文件中保存的标签索引和根据节点生成的索引
+func checkTagIndex() ([]string, error) {
+	stored, err := config.StoredTagIndex()
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		if config.GlobalConfig.WriteTagIndex {
+			return []string{"tag_index: missing"}, nil
+		}
+		return nil, nil
+	}
+
+	derived := config.BuildTagIndex(config.GlobalNode.Nodes)
+	exists := make(map[string]bool)
+	for _, node := range config.GlobalNode.Nodes {
+		exists[node.ID()] = true
+	}
+
+	var problems []string
+	for _, tag := range sortedKeys(stored) {
+		seen := make(map[string]bool)
+		for _, id := range stored[tag] {
+			switch {
+			case seen[id]:
+				problems = append(problems, fmt.Sprintf("tag_index: #%s lists %s more than once", tag, id))
+			case !exists[id]:
+				problems = append(problems, fmt.Sprintf("tag_index: #%s lists %s which does not exist", tag, id))
+			case !slices.Contains(derived[tag], id):
+				problems = append(problems, fmt.Sprintf("tag_index: #%s lists %s which is not tagged #%s", tag, id, tag))
+			}
+			seen[id] = true
+		}
+	}
+	for _, tag := range sortedKeys(derived) {
+		for _, id := range derived[tag] {
+			if !slices.Contains(stored[tag], id) {
+				problems = append(problems, fmt.Sprintf("tag_index: #%s is missing %s", tag, id))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// 修复节点数据中的问题，返回每个问题的说明
+func fixNodes(nodes *config.NodesFile, key *utils.VaultKey) []string {
+	var problems []string
+
+	// 相同标识的节点只保留第一个
+	ids := make(map[string]bool)
+	aliases := make(map[string]string)
+	kept := nodes.Nodes[:0]
+	for _, node := range nodes.Nodes {
+		if ids[node.ID()] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate node, the later entry is removed", node.ID()))
+			continue
+		}
+		ids[node.ID()] = true
+
+		if owner, ok := aliases[node.Alias]; ok && node.Alias != "" {
+			problems = append(problems, fmt.Sprintf("%s: alias %s is already used by %s, the alias is removed", node.ID(), node.Alias, owner))
+			node.Alias = ""
+		} else if node.Alias != "" {
+			aliases[node.Alias] = node.ID()
+		}
+		kept = append(kept, node)
+	}
+	nodes.Nodes = kept
+
+	// 无法解密的字段无法恢复，清空后需要重新设置
+	if nodes.Proxy != nil && !canDecrypt(nodes.Proxy.Password, key) {
+		problems = append(problems, "proxy: password cannot be decrypted and is cleared")
+		nodes.Proxy.Password = ""
+	}
+	for i := range nodes.Nodes {
+		node := &nodes.Nodes[i]
+		for _, field := range node.SecretFields() {
+			if !canDecrypt(*field.Value, key) {
+				problems = append(problems, fmt.Sprintf("%s: %s cannot be decrypted and is cleared", node.ID(), field.Name))
+				*field.Value = ""
+			}
+		}
+	}
+	return problems
+}
+
+// 所有加密字段都可以使用当前密钥解密
+func canDecryptAll(nodes config.NodesFile, key *utils.VaultKey) bool {
+	for _, secret := range nodes.Secrets() {
+		if !canDecrypt(*secret, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// 字段为空或可以使用当前密钥解密
+func canDecrypt(cipherText string, key *utils.VaultKey) bool {
+	if cipherText == "" {
+		return true
+	}
+	_, err := utils.DecryptAES(cipherText, key)
+	return err == nil
+}
+
+// 按字母顺序返回映射的键
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+
+	fsckCmd.Flags().BoolVarP(&repair, "repair", "", false, "Back up node.yaml and repair the problems found.")
+}
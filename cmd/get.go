@@ -10,29 +10,24 @@ import (
 
 // get 命令
 var getCmd = &cobra.Command{
-	Use:   "get <IP>",
+	Use:   "get <host[:port]>",
 	Short: "Get info of a specific node.",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
-		ip := args[0]
-
-		// 检查 IP 地址合法性
-		if err := utils.AssertIpAddressValid(ip); err != nil {
-			return fmt.Errorf("invalid IP address: %w", err)
-		}
+		address := args[0]
 
 		// 获取节点信息
-		nodes, err := config.GetNode(ip, user)
+		nodes, err := findNodes(address)
 		if err != nil {
-			return fmt.Errorf("failed to retrieve nodes: %w", err)
+			return err
 		}
 		if len(nodes) == 0 {
-			return fmt.Errorf("no data matching IP %s was found", ip)
+			return fmt.Errorf("no data matching %s was found", address)
 		}
 
 		// 选择节点
-		node, err := selectNode(ip, nodes)
+		node, err := selectNode(address, nodes)
 		if err != nil {
 			return err
 		}
@@ -40,18 +35,66 @@ var getCmd = &cobra.Command{
 	},
 }
 
+// 根据别名、节点标识或 host[:port] 参数和 -u 参数查找节点
+func findNodes(address string) ([]config.Node, error) {
+	// 优先匹配别名和完整的节点标识
+	if node, ok := config.FindNode(address); ok {
+		return []config.Node{node}, nil
+	}
+
+	// 检查地址合法性
+	host, port, err := utils.ParseHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+
+	nodes, err := config.GetNode(host, port, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+// 查找并选择参数对应的唯一节点
+func resolveNode(address string) (config.Node, error) {
+	// 获取节点信息
+	nodes, err := findNodes(address)
+	if err != nil {
+		return config.Node{}, err
+	}
+	if len(nodes) == 0 {
+		return config.Node{}, fmt.Errorf("no data matching %s was found", address)
+	}
+
+	// 选择节点
+	return selectNode(address, nodes)
+}
+
 // 选择节点
-func selectNode(ip string, nodes []config.Node) (config.Node, error) {
+func selectNode(address string, nodes []config.Node) (config.Node, error) {
 	if len(nodes) == 1 {
 		return nodes[0], nil
 	}
 
+	// 同一用户名存在于多个端口时需要输入完整标识
+	usernameCount := map[string]int{}
+	for _, node := range nodes {
+		usernameCount[node.Username]++
+	}
+
 	// 多个用户记录时提示用户选择
-	fmt.Printf("\nIP %s has multiple user records:\n", ip)
+	fmt.Printf("\n%s has multiple user records:\n", address)
 	userMap := map[string]config.Node{}
 	for _, node := range nodes {
-		fmt.Printf("%s, ", node.Username)
-		userMap[node.Username] = node
+		if usernameCount[node.Username] == 1 && node.SSHPort() == config.DefaultPort {
+			fmt.Printf("%s, ", node.Username)
+		} else {
+			fmt.Printf("%s, ", node.ID())
+		}
+		if usernameCount[node.Username] == 1 {
+			userMap[node.Username] = node
+		}
+		userMap[node.ID()] = node
 	}
 	fmt.Print("\nPlease select one of them (default: root): ")
 
@@ -69,7 +112,7 @@ func selectNode(ip string, nodes []config.Node) (config.Node, error) {
 	// 查找用户对应的节点
 	node, exists := userMap[inputUser]
 	if !exists {
-		return config.Node{}, fmt.Errorf("no data matching IP %s and username %s was found", ip, inputUser)
+		return config.Node{}, fmt.Errorf("no data matching %s and username %s was found", address, inputUser)
 	}
 
 	return node, nil
@@ -78,17 +121,52 @@ func selectNode(ip string, nodes []config.Node) (config.Node, error) {
 // 打印节点信息
 func printNodeInfo(node config.Node, printPassword bool) error {
 	fmt.Println("\nFound Node!")
-	fmt.Printf("IP: %s\n", node.IP)
+	if node.Alias != "" {
+		fmt.Printf("Alias: %s\n", node.Alias)
+	}
+	if node.IP != "" {
+		fmt.Printf("IP: %s\n", node.IP)
+	}
+	if node.Host != "" {
+		fmt.Printf("Host: %s\n", node.Host)
+	}
+	fmt.Printf("Port: %d\n", node.SSHPort())
 	fmt.Printf("Username: %s\n", node.Username)
 
-	if printPassword {
-		password, err := utils.DecryptAES(node.Password, config.GlobalConfig.SecretKey)
+	if printPassword && node.Password != "" {
+		password, err := decryptSecret(node.Password)
 		if err != nil {
 			return fmt.Errorf("failed to decrypt password: %w", err)
 		}
 		fmt.Printf("Password: %s\n", password)
 	}
 
+	if node.KeyPath != "" {
+		fmt.Printf("Private key: %s\n", node.KeyPath)
+	}
+	if node.PrivateKey != "" {
+		fmt.Println("Private key: imported into the vault")
+	}
+
+	if len(node.Jump) > 0 {
+		fmt.Printf("Jump: %s\n", strings.Join(node.Jump, " -> "))
+	}
+
+	for _, spec := range node.LocalForwards {
+		fmt.Printf("Local forward: %s\n", spec)
+	}
+	for _, spec := range node.RemoteForwards {
+		fmt.Printf("Remote forward: %s\n", spec)
+	}
+	for _, spec := range node.DynamicForwards {
+		fmt.Printf("Dynamic forward: %s\n", spec)
+	}
+	if node.KeepaliveInterval > 0 {
+		fmt.Printf("Keepalive: %ds\n", node.KeepaliveInterval)
+	} else if node.KeepaliveInterval < 0 {
+		fmt.Println("Keepalive: off")
+	}
+
 	if len(node.Tags) > 0 {
 		fmt.Printf("Tags: %s\n", "#"+strings.Join(node.Tags, " #"))
 	}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
+	"sshe/config"
+	"strings"
+)
+
+// 主机密钥校验策略
+const (
+	hostKeyPolicyStrict   = "strict"
+	hostKeyPolicyTOFU     = "tofu"
+	hostKeyPolicyInsecure = "insecure"
+)
+
+var (
+	// 命令行指定的主机密钥校验策略
+	hostKeyPolicyFlag string
+)
+
+// 校验主机密钥校验策略
+func assertHostKeyPolicyValid(policy string) error {
+	switch policy {
+	case "", hostKeyPolicyStrict, hostKeyPolicyTOFU, hostKeyPolicyInsecure:
+		return nil
+	default:
+		return fmt.Errorf("invalid host key policy %s, must be one of strict, tofu, insecure", policy)
+	}
+}
+
+// 获取节点生效的主机密钥校验策略：命令行 > 节点配置 > 全局配置 > tofu
+func resolveHostKeyPolicy(node config.Node) (string, error) {
+	for _, policy := range []string{hostKeyPolicyFlag, node.HostKeyPolicy, config.GlobalConfig.HostKeyPolicy} {
+		if policy == "" {
+			continue
+		}
+		if err := assertHostKeyPolicyValid(policy); err != nil {
+			return "", err
+		}
+		return policy, nil
+	}
+	return hostKeyPolicyTOFU, nil
+}
+
+// 为客户端配置设置主机密钥校验
+func setupHostKeyCheck(clientConfig *ssh.ClientConfig, node config.Node, address string) error {
+	policy, err := resolveHostKeyPolicy(node)
+	if err != nil {
+		return err
+	}
+	if policy == hostKeyPolicyInsecure {
+		clientConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return nil
+	}
+
+	// 确保 sshe 的 known_hosts 文件存在
+	file, err := os.OpenFile(config.KnownHostsPath, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts: %w", err)
+	}
+	_ = file.Close()
+
+	files := []string{config.KnownHostsPath}
+	if config.GlobalConfig.SystemKnownHosts {
+		if _, err := os.Stat(config.SystemKnownHostsPath); err == nil {
+			files = append(files, config.SystemKnownHostsPath)
+		}
+	}
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+
+	// 已记录的主机优先协商已知的密钥类型，避免误报密钥变更
+	clientConfig.HostKeyAlgorithms = knownHostKeyAlgorithms(callback, address)
+	clientConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return hostKeyMismatchError(hostname, key, keyErr.Want)
+		}
+		if policy == hostKeyPolicyStrict {
+			return fmt.Errorf("host key for %s is unknown (%s %s) and host key policy is strict", hostname, key.Type(), ssh.FingerprintSHA256(key))
+		}
+		return trustOnFirstUse(hostname, key)
+	}
+	return nil
+}
+
+// 查询已记录的主机密钥类型
+func knownHostKeyAlgorithms(callback ssh.HostKeyCallback, address string) []string {
+	// 使用一个不可能匹配的密钥查询，从错误中取出已记录的密钥
+	err := callback(address, &net.TCPAddr{}, unknownPublicKey{})
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch known.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, known.Key.Type())
+		}
+	}
+	return algorithms
+}
+
+// 主机密钥与记录不一致
+func hostKeyMismatchError(hostname string, key ssh.PublicKey, known []knownhosts.KnownKey) error {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED FOR %s!\n", hostname))
+	builder.WriteString("Someone could be eavesdropping on you right now (man-in-the-middle attack)!\n")
+	for _, want := range known {
+		builder.WriteString(fmt.Sprintf("Known key:    %s %s (%s:%d)\n", want.Key.Type(), ssh.FingerprintSHA256(want.Key), want.Filename, want.Line))
+	}
+	builder.WriteString(fmt.Sprintf("Received key: %s %s\n", key.Type(), ssh.FingerprintSHA256(key)))
+	builder.WriteString("Host key verification failed, remove the old entry from known_hosts if the change is expected")
+	return errors.New(builder.String())
+}
+
+// 首次连接时提示用户确认并记录主机密钥
+func trustOnFirstUse(hostname string, key ssh.PublicKey) error {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	fmt.Printf("\nThe authenticity of host '%s' can't be established.\n", hostname)
+	fmt.Printf("%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+	fmt.Print("Are you sure you want to continue connecting (yes/no)? ")
+
+	var answer string
+	var err error
+	if stdin.active() {
+		// link 重新连接时标准输入已由读取协程接管，从中读取
+		answer, err = stdin.readLine()
+		answer = strings.TrimSpace(answer)
+	} else {
+		_, err = fmt.Scanln(&answer)
+		if err != nil && err.Error() == "unexpected newline" {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error reading the confirmation: %w", err)
+	}
+	if answer != "yes" && answer != "y" {
+		return errors.New("host key verification failed")
+	}
+
+	file, err := os.OpenFile(config.KnownHostsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts: %w", err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := file.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	fmt.Printf("Warning: Permanently added '%s' (%s) to the list of known hosts.\n", hostname, key.Type())
+	return nil
+}
+
+// 用于查询已记录密钥的占位公钥
+type unknownPublicKey struct{}
+
+func (unknownPublicKey) Type() string    { return "sshe-unknown" }
+func (unknownPublicKey) Marshal() []byte { return []byte{} }
+func (unknownPublicKey) Verify(data []byte, sig *ssh.Signature) error {
+	return errors.New("not supported")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"sshe/config"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 命令行参数指定的心跳间隔（秒）
+var keepaliveFlag int
+
+// 连接已断开
+var errConnectionLost = errors.New("connection lost")
+
+// 连接心跳，连续多次未响应时关闭连接
+type keepalive struct {
+	dead     atomic.Bool
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// 节点使用的心跳间隔，优先级：命令行参数 > 节点配置 > 全局配置
+func keepaliveInterval(node config.Node) time.Duration {
+	seconds := config.GlobalConfig.KeepaliveInterval
+	if node.KeepaliveInterval != 0 {
+		seconds = node.KeepaliveInterval
+	}
+	if keepaliveFlag != 0 {
+		seconds = keepaliveFlag
+	}
+	if seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// 按节点配置定期发送 keepalive@openssh.com 请求
+func startKeepalive(client *ssh.Client, node config.Node) *keepalive {
+	k := &keepalive{done: make(chan struct{})}
+	interval := keepaliveInterval(node)
+	if interval <= 0 {
+		return k
+	}
+	countMax := config.GlobalConfig.KeepaliveCountMax
+	if countMax <= 0 {
+		countMax = 3
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// 同一时间只有一个未响应的请求，等待期间每个周期计一次未响应
+		replies := make(chan error, 1)
+		pending, missed := false, 0
+		for {
+			select {
+			case <-k.done:
+				return
+			case err := <-replies:
+				if err != nil {
+					// 连接已经关闭
+					return
+				}
+				pending, missed = false, 0
+			case <-ticker.C:
+				if !pending {
+					pending = true
+					go func() {
+						// 服务端不认识该请求时也会回复失败，同样说明连接正常
+						_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+						replies <- err
+					}()
+					continue
+				}
+				missed++
+				if missed >= countMax {
+					k.dead.Store(true)
+					_ = client.Close()
+					return
+				}
+			}
+		}
+	}()
+	return k
+}
+
+// Dead 连接是否因心跳超时被关闭
+func (k *keepalive) Dead() bool {
+	return k.dead.Load()
+}
+
+// Stop 停止发送心跳
+func (k *keepalive) Stop() {
+	k.stopOnce.Do(func() {
+		close(k.done)
+	})
+}
@@ -1,52 +1,47 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/creack/pty"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"io"
+	"net"
 	"os"
 	"os/signal"
 	"sshe/config"
 	"sshe/utils"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
-	"time"
+)
+
+var (
+	// 是否开启 agent 转发
+	forwardAgentFlag bool
+	// 连接断开时是否提示重新连接
+	reconnectFlag bool
 )
 
 // link 命令
 var linkCmd = &cobra.Command{
-	Use:   "link <IP>",
+	Use:   "link <host[:port]>",
 	Short: "Connect to a matching node.",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
-		ip := args[0]
-		// 检查 IP 地址合法性
-		if err := utils.AssertIpAddressValid(ip); err != nil {
-			return fmt.Errorf("invalid IP address: %w", err)
-		}
-
-		// 获取节点信息
-		nodes, err := config.GetNode(ip, user)
-		if err != nil {
-			return fmt.Errorf("failed to retrieve nodes: %w", err)
-		}
-		if len(nodes) == 0 {
-			return fmt.Errorf("no data matching IP %s was found", ip)
-		}
-
-		// 选择节点
-		node, err := selectNode(ip, nodes)
-		if err != nil {
-			return err
-		}
+		address := args[0]
 
-		password, err := utils.DecryptAES(node.Password, config.GlobalConfig.SecretKey)
+		// 查找并选择节点
+		node, err := resolveNode(address)
 		if err != nil {
 			return err
 		}
 
-		err = sshConnect(node, password)
+		err = sshConnect(node)
 		if err != nil {
 			return err
 		}
@@ -55,30 +50,81 @@ var linkCmd = &cobra.Command{
 	},
 }
 
-// 使用 SSH 连接到节点
-func sshConnect(node config.Node, password string) error {
-	// 创建 SSH 客户端配置
-	clientConfig := &ssh.ClientConfig{
-		User: node.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
+// 使用 SSH 连接到节点，连接断开且开启了 --reconnect 时提示重新连接
+func sshConnect(node config.Node) error {
+	// 校验端口转发参数
+	rules, err := nodeForwards(node)
+	if err != nil {
+		return err
+	}
+
+	// 开始录制会话，重新连接时继续写入同一个文件
+	recorder, recordPath, err := startRecording(node)
+	if err != nil {
+		return err
+	}
+	if recorder != nil {
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				fmt.Printf("Failed to save recording: %v\n", err)
+				return
+			}
+			fmt.Printf("Session recorded to %s\n", recordPath)
+		}()
 	}
 
+	for {
+		err := connectShell(node, rules, recorder)
+		if !errors.Is(err, errConnectionLost) || !reconnectFlag {
+			return err
+		}
+		fmt.Printf("\nConnection to %s lost. Reconnect? [Y/n]: ", node.ID())
+		answer, readErr := stdin.readLine()
+		if readErr != nil {
+			return err
+		}
+		answer = strings.TrimSpace(answer)
+		if answer != "" && !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return err
+		}
+	}
+}
+
+// 建立一次连接，打开端口转发和交互式 shell，连接意外断开时返回 errConnectionLost
+func connectShell(node config.Node, rules []forwardRule, recorder *utils.CastRecorder) error {
 	// 连接到远程节点
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:22", node.IP), clientConfig)
+	client, err := dialNode(node)
 	if err != nil {
-		return fmt.Errorf("failed to connect to SSH server: %w", err)
+		return err
 	}
 	defer func(client *ssh.Client) {
 		err := client.Close()
-		if err != nil && err.Error() != "EOF" {
+		if err != nil && err.Error() != "EOF" && !errors.Is(err, net.ErrClosed) {
 			fmt.Printf("Failed to close SSH client: %v\n", err)
 		}
 	}(client)
 
+	// 建立端口转发
+	forwards, err := startForwards(client, rules, terminalLogf)
+	if err != nil {
+		return err
+	}
+	defer forwards.Close()
+
+	// 发送心跳检测连接状态
+	alive := startKeepalive(client, node)
+	defer alive.Stop()
+
+	err = runShell(client, node, recorder)
+	var missingErr *ssh.ExitMissingError
+	if alive.Dead() || errors.As(err, &missingErr) {
+		return fmt.Errorf("%s: %w", node.ID(), errConnectionLost)
+	}
+	return err
+}
+
+// 在已建立的连接上打开交互式 shell，recorder 不为空时同时录制会话
+func runShell(client *ssh.Client, node config.Node, recorder *utils.CastRecorder) error {
 	// 创建一个新的 SSH 会话
 	session, err := client.NewSession()
 	if err != nil {
@@ -92,46 +138,236 @@ func sshConnect(node config.Node, password string) error {
 		fmt.Print("\033c")
 	}(session)
 
+	// 开启 agent 转发
+	if forwardAgentFlag || node.ForwardAgent {
+		if err := forwardAgent(client, session); err != nil {
+			return err
+		}
+	}
+
 	// 设置会话的输入和输出，连接到本地终端
+	input := stdin.reader()
+	defer input.Close()
 	session.Stdout = os.Stdout
 	session.Stderr = os.Stderr
-	session.Stdin = os.Stdin
+	session.Stdin = input
+	var onResize func(cols, rows int)
+	if recorder != nil {
+		session.Stdout = io.MultiWriter(os.Stdout, recorder.Output())
+		session.Stderr = io.MultiWriter(os.Stderr, recorder.Output())
+		if recordInput {
+			session.Stdin = io.TeeReader(input, recorder.Input())
+		}
+		onResize = recorder.Resize
+	}
+
+	// 请求伪终端并将本地终端切换为 raw 模式
+	restore, err := requestTerminal(session)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	// 启动交互式 shell 会话
+	if err := session.Shell(); err != nil {
+		return fmt.Errorf("failed to start shell: %w", err)
+	}
+	defer watchTerminalSignals(session, onResize)()
 
-	// 获取当前终端的尺寸
+	// 等待会话结束
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("session exited with error: %w", err)
+	}
+
+	return nil
+}
+
+// 使用本地终端类型和尺寸为会话请求伪终端（Pty），本地终端切换为 raw 模式，返回恢复终端的函数
+func requestTerminal(session *ssh.Session) (func(), error) {
+	// 获取当前终端的尺寸，标准输出不是终端时使用默认尺寸
 	rows, cols, err := pty.Getsize(os.Stdout)
-	fmt.Printf("width = %d height = %d", cols, rows)
 	if err != nil {
-		return fmt.Errorf("failed to get terminal size: %w", err)
+		rows, cols = 24, 80
 	}
 
-	// 请求伪终端（Pty）模拟交互式 shell 环境
-	if err := session.RequestPty("vt100", rows, cols, ssh.TerminalModes{
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "vt100"
+	}
+	if err := session.RequestPty(termType, rows, cols, ssh.TerminalModes{
 		ssh.ECHO:          1,
 		ssh.TTY_OP_ISPEED: 14400,
 		ssh.TTY_OP_OSPEED: 14400,
 	}); err != nil {
-		return fmt.Errorf("failed to request pseudo terminal: %w", err)
+		return nil, fmt.Errorf("failed to request pseudo terminal: %w", err)
 	}
 
-	// 启动交互式 shell 会话
-	if err := session.Shell(); err != nil {
-		return fmt.Errorf("failed to start shell: %w", err)
+	// 按键原样发送到远程
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return func() {}, nil
 	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set terminal to raw mode: %w", err)
+	}
+	return func() {
+		_ = term.Restore(fd, oldState)
+	}, nil
+}
 
-	// 捕获 SIGINT 信号并忽略它
+// 窗口大小变化时同步到远程终端并调用 onResize（可以为 nil）；收到退出信号时关闭会话，确保本地终端得到恢复。返回停止监听的函数
+func watchTerminalSignals(session *ssh.Session, onResize func(cols, rows int)) func() {
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT)
-
-	// 等待会话结束或 SIGINT 信号
+	signal.Notify(sigCh, syscall.SIGWINCH, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	done := make(chan struct{})
 	go func() {
-		<-sigCh // 等待 SIGINT 信号
+		for {
+			select {
+			case sig := <-sigCh:
+				switch sig {
+				case syscall.SIGWINCH:
+					if rows, cols, err := pty.Getsize(os.Stdout); err == nil {
+						_ = session.WindowChange(rows, cols)
+						if onResize != nil {
+							onResize(cols, rows)
+						}
+					}
+				case syscall.SIGINT:
+					// raw 模式下 Ctrl+C 会直接发送到远程，忽略本地 SIGINT
+				default:
+					_ = session.Close()
+				}
+			case <-done:
+				return
+			}
+		}
 	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
 
-	// 等待会话结束
-	if err := session.Wait(); err != nil {
-		return fmt.Errorf("session exited with error: %w", err)
+// 本地标准输入，由一个协程统一读取，会话结束后不再占用后续输入
+var stdin = &inputPump{}
+
+// 标准输入的读取协程，读取到的数据依次交给当前的读取者
+type inputPump struct {
+	once    sync.Once
+	running atomic.Bool
+	data    chan []byte
+	err     error
+}
+
+func (p *inputPump) start() {
+	p.once.Do(func() {
+		p.running.Store(true)
+		p.data = make(chan []byte)
+		go func() {
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					p.data <- append([]byte(nil), buf[:n]...)
+				}
+				if err != nil {
+					p.err = err
+					close(p.data)
+					return
+				}
+			}
+		}()
+	})
+}
+
+// 返回一个新的读取者，关闭后不再读取标准输入
+func (p *inputPump) reader() *inputReader {
+	p.start()
+	return &inputReader{pump: p, done: make(chan struct{})}
+}
+
+// 读取协程是否已启动，启动后其他地方不能再直接读取标准输入，否则会与其争抢输入
+func (p *inputPump) active() bool {
+	return p.running.Load()
+}
+
+// 读取一行输入，不包含换行符
+func (p *inputPump) readLine() (string, error) {
+	line, err := p.scanLine(false)
+	return string(line), err
+}
+
+// 读取一行不回显的输入，终端临时切换为 raw 模式以关闭回显
+func (p *inputPump) readPassword() ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = term.Restore(fd, state)
+		}()
 	}
+	return p.scanLine(true)
+}
+
+// 从读取协程读取一行，raw 模式下自行处理退格和 Ctrl-C
+func (p *inputPump) scanLine(raw bool) ([]byte, error) {
+	r := p.reader()
+	defer r.Close()
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			return line, err
+		}
+		switch {
+		case buf[0] == '\n' || buf[0] == '\r':
+			return line, nil
+		case raw && buf[0] == 3:
+			return nil, errors.New("interrupted")
+		case raw && (buf[0] == 127 || buf[0] == '\b'):
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		default:
+			line = append(line, buf[0])
+		}
+	}
+}
+
+// 标准输入的读取者
+type inputReader struct {
+	pump      *inputPump
+	done      chan struct{}
+	closeOnce sync.Once
+	pending   []byte
+}
+
+func (r *inputReader) Read(b []byte) (int, error) {
+	if len(r.pending) == 0 {
+		select {
+		case data, ok := <-r.pump.data:
+			if !ok {
+				return 0, r.pump.err
+			}
+			r.pending = data
+		case <-r.done:
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
 
+// Close 停止读取
+func (r *inputReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
 	return nil
 }
 
@@ -140,4 +376,13 @@ func init() {
 
 	// 设置 link 命令的标志
 	linkCmd.Flags().StringVarP(&user, "user", "u", "", "Specifies the username for connection.")
+	linkCmd.Flags().BoolVarP(&forwardAgentFlag, "forward-agent", "A", false, "Enable forwarding of the local ssh-agent to the node.")
+	linkCmd.Flags().StringArrayVarP(&localForwards, "local-forward", "L", []string{}, "Forward a local port to a remote address: [bind:]port:host:hostport.")
+	linkCmd.Flags().StringArrayVarP(&remoteForwards, "remote-forward", "R", []string{}, "Forward a remote port to a local address: [bind:]port:host:hostport.")
+	linkCmd.Flags().StringArrayVarP(&dynamicForwards, "dynamic-forward", "D", []string{}, "Start a local SOCKS5 proxy tunneled through the node: [bind:]port.")
+	linkCmd.Flags().IntVarP(&keepaliveFlag, "keepalive", "", 0, "Send a keepalive every N seconds and disconnect after keepalive_count_max missed replies, -1 disables.")
+	linkCmd.Flags().BoolVarP(&reconnectFlag, "reconnect", "", false, "Offer to reconnect with the same forwards when the connection is lost.")
+	linkCmd.Flags().BoolVarP(&recordSession, "record", "", false, "Record the session output to ~/.sshe/recordings/<node>/<time>.cast (asciicast v2).")
+	linkCmd.Flags().BoolVarP(&recordInput, "record-input", "", false, "Also record the keyboard input, implies --record. Passwords typed in the session are recorded too.")
+	linkCmd.Flags().StringVarP(&hostKeyPolicyFlag, "host-key-policy", "", "", "Override the host key policy: strict, tofu or insecure.")
 }
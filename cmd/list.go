@@ -30,30 +30,8 @@ var listCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
 
-		// 获取所有节点
-		nodes := config.GlobalNode.Nodes
-		var matchedNodes []config.Node
-
-		// 遍历所有节点，进行筛选
-		for _, node := range nodes {
-			// 检查 IP 相关条件
-			if !matchIPs(node.IP) {
-				continue
-			}
-
-			// 检查用户名相关条件
-			if !matchUsers(node.Username) {
-				continue
-			}
-
-			// 检查标签相关条件
-			if !matchTags(node.Tags) {
-				continue
-			}
-
-			// 如果节点符合所有条件，则加入匹配结果
-			matchedNodes = append(matchedNodes, node)
-		}
+		// 筛选节点
+		matchedNodes := filterNodes()
 
 		// 输出结果
 		// 如果没有匹配的节点
@@ -61,24 +39,24 @@ var listCmd = &cobra.Command{
 			fmt.Println("No matching nodes found.")
 		} else {
 			// 计算最大宽度
-			maxIPLen := len("IP")
+			maxIPLen := len("Address")
 			maxUserLen := len("Username")
 			maxTagLen := len("Tags")
 
 			// 计算每列的最大宽度
 			for _, node := range matchedNodes {
-				maxIPLen = max(maxIPLen, len(node.IP))
+				maxIPLen = max(maxIPLen, len(node.HostPort()))
 				maxUserLen = max(maxUserLen, len(node.Username))
 				maxTagLen = max(maxTagLen, len(formatTags(node.Tags)))
 			}
 
 			// 打印表头
-			fmt.Printf("%-*s %-*s %-*s\n", maxIPLen, "IP", maxUserLen, "Username", maxTagLen, "Tags")
+			fmt.Printf("%-*s %-*s %-*s\n", maxIPLen, "Address", maxUserLen, "Username", maxTagLen, "Tags")
 
 			// 打印每个节点的信息
 			for _, node := range matchedNodes {
 				// 使用动态宽度的格式化输出对齐每列
-				fmt.Printf("%-*s %-*s %-*s\n", maxIPLen, node.IP, maxUserLen, node.Username, maxTagLen, formatTags(node.Tags))
+				fmt.Printf("%-*s %-*s %-*s\n", maxIPLen, node.HostPort(), maxUserLen, node.Username, maxTagLen, formatTags(node.Tags))
 			}
 		}
 
@@ -86,6 +64,44 @@ var listCmd = &cobra.Command{
 	},
 }
 
+// 根据筛选条件匹配节点
+func filterNodes() []config.Node {
+	var matchedNodes []config.Node
+
+	// 遍历所有节点，进行筛选
+	for _, node := range config.GlobalNode.Nodes {
+		// 检查地址相关条件
+		if !matchIPs(node.Address()) {
+			continue
+		}
+
+		// 检查用户名相关条件
+		if !matchUsers(node.Username) {
+			continue
+		}
+
+		// 检查标签相关条件
+		if !matchTags(node.Tags) {
+			continue
+		}
+
+		// 如果节点符合所有条件，则加入匹配结果
+		matchedNodes = append(matchedNodes, node)
+	}
+	return matchedNodes
+}
+
+// 是否设置了任一筛选条件
+func hasFilters() bool {
+	for _, values := range [][]string{ips, ipStarts, ipEnds, ipContains, users, userStarts, userEnds, userContains,
+		conditionTags, conditionTagStarts, conditionTagEnds, conditionTagContains} {
+		if len(values) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func formatTags(tags []string) string {
 	if len(tags) == 0 {
 		return "No tags"
@@ -97,7 +113,7 @@ func formatTags(tags []string) string {
 	return tagString
 }
 
-// 根据 IP 条件进行匹配
+// 根据 IP 或域名条件进行匹配
 func matchIPs(ip string) bool {
 	if len(ips) > 0 && !contains(ips, ip) {
 		return false
@@ -219,18 +235,23 @@ func containsAny(tags []string, substr string) bool {
 func init() {
 	rootCmd.AddCommand(listCmd)
 
-	listCmd.Flags().StringArrayVarP(&ips, "ip", "i", []string{}, "Search by IP address.")
-	listCmd.Flags().StringArrayVarP(&ipStarts, "ip-start", "", []string{}, "Search by the beginning of the IP address.")
-	listCmd.Flags().StringArrayVarP(&ipEnds, "ip-end", "", []string{}, "Search by the end of the IP address.")
-	listCmd.Flags().StringArrayVarP(&ipContains, "ip-contain", "", []string{}, "Search by the content contained in the IP address.")
+	addFilterFlags(listCmd)
+}
+
+// 为命令添加节点筛选参数
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&ips, "ip", "i", []string{}, "Search by IP address.")
+	cmd.Flags().StringArrayVarP(&ipStarts, "ip-start", "", []string{}, "Search by the beginning of the IP address.")
+	cmd.Flags().StringArrayVarP(&ipEnds, "ip-end", "", []string{}, "Search by the end of the IP address.")
+	cmd.Flags().StringArrayVarP(&ipContains, "ip-contain", "", []string{}, "Search by the content contained in the IP address.")
 
-	listCmd.Flags().StringArrayVarP(&users, "user", "u", []string{}, "Search by username.")
-	listCmd.Flags().StringArrayVarP(&userStarts, "user-start", "", []string{}, "Search by the beginning of the username.")
-	listCmd.Flags().StringArrayVarP(&userEnds, "user-end", "", []string{}, "Search by the end of the username.")
-	listCmd.Flags().StringArrayVarP(&userContains, "user-contain", "", []string{}, "Search by the content contained in the username.")
+	cmd.Flags().StringArrayVarP(&users, "user", "u", []string{}, "Search by username.")
+	cmd.Flags().StringArrayVarP(&userStarts, "user-start", "", []string{}, "Search by the beginning of the username.")
+	cmd.Flags().StringArrayVarP(&userEnds, "user-end", "", []string{}, "Search by the end of the username.")
+	cmd.Flags().StringArrayVarP(&userContains, "user-contain", "", []string{}, "Search by the content contained in the username.")
 
-	listCmd.Flags().StringArrayVarP(&conditionTags, "tag", "t", []string{}, "Search by tag.")
-	listCmd.Flags().StringArrayVarP(&conditionTagStarts, "tag-start", "", []string{}, "Search by the beginning of the tag.")
-	listCmd.Flags().StringArrayVarP(&conditionTagEnds, "tag-end", "", []string{}, "Search by the end of the tag.")
-	listCmd.Flags().StringArrayVarP(&conditionTagContains, "tag-contain", "", []string{}, "Search by the content contained in the tag.")
+	cmd.Flags().StringArrayVarP(&conditionTags, "tag", "t", []string{}, "Search by tag.")
+	cmd.Flags().StringArrayVarP(&conditionTagStarts, "tag-start", "", []string{}, "Search by the beginning of the tag.")
+	cmd.Flags().StringArrayVarP(&conditionTagEnds, "tag-end", "", []string{}, "Search by the end of the tag.")
+	cmd.Flags().StringArrayVarP(&conditionTagContains, "tag-contain", "", []string{}, "Search by the content contained in the tag.")
 }
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"sshe/config"
+)
+
+// 只显示需要执行的迁移
+var dryRun bool
+
+// migrate 命令
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade node.yaml to the current format version.",
+	Long:  `Upgrade node.yaml to the current format version. Other commands migrate the file automatically on load; the original file is backed up to node.yaml.v<version>.<time>.bak before it is rewritten.`,
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		if dryRun {
+			plan, err := config.PlanMigration()
+			if err != nil {
+				return err
+			}
+			if plan == nil {
+				fmt.Printf("node.yaml is up to date (version %d).\n", config.CurrentVersion)
+				return nil
+			}
+			fmt.Printf("node.yaml would be migrated from version %d to %d:\n", plan.From, plan.To)
+			printMigrationChanges(plan)
+			return nil
+		}
+
+		plan, backupPath, err := config.Migrate()
+		if err != nil {
+			return err
+		}
+		if plan == nil {
+			fmt.Printf("node.yaml is up to date (version %d).\n", config.CurrentVersion)
+			return nil
+		}
+		fmt.Printf("node.yaml has been migrated from version %d to %d:\n", plan.From, plan.To)
+		printMigrationChanges(plan)
+		fmt.Printf("Backup saved to %s\n", backupPath)
+		return nil
+	},
+}
+
+// 输出迁移中的每一处修改
+func printMigrationChanges(plan *config.MigrationPlan) {
+	for _, change := range plan.Changes {
+		fmt.Printf("  %s\n", change)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Show what would change without writing node.yaml.")
+}
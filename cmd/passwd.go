@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"sshe/config"
+)
+
+// passwd 命令
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Set or change the master password of the vault.",
+	Long:  `Protect the vault with a master password prompted at runtime. Every stored password is re-encrypted with a key derived from the master password, and secret_key is removed from sshe.conf.`,
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		// 使用当前密钥解锁，旧版密文也需要重新加密
+		oldKey, err := unlockLegacyVault()
+		if err != nil {
+			return err
+		}
+
+		// 输入新的主密码
+		password, err := readNewMasterPassword()
+		if err != nil {
+			return err
+		}
+
+		// 配置中不再保存秘钥串
+		conf := config.GlobalConfig
+		conf.SecretKey = ""
+		conf.MasterPassword = true
+
+		if err := rekeyVault(oldKey, password, conf); err != nil {
+			return err
+		}
+
+		fmt.Println("Master password has been set successfully!")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(passwdCmd)
+}
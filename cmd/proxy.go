@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/proxy"
+	"golang.org/x/term"
+	"net/url"
+	"sshe/config"
+	"sshe/utils"
+	"time"
+)
+
+// proxy 命令
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Show the global proxy used for SSH connections.",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if config.GlobalNode.Proxy == nil {
+			fmt.Println("No global proxy configured.")
+			return
+		}
+		fmt.Printf("Proxy: %s\n", config.GlobalNode.Proxy.URL)
+	},
+}
+
+// proxy set 命令
+var proxySetCmd = &cobra.Command{
+	Use:   "set <URL>",
+	Short: "Set the global proxy, e.g. socks5://user@127.0.0.1:1080 or http://proxy:3128.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		p, err := parseProxyInput(args[0])
+		if err != nil {
+			return err
+		}
+		if p.URL == config.ProxyDirect {
+			return fmt.Errorf("%s can only be used as a node proxy", config.ProxyDirect)
+		}
+		if err := config.SetProxy(p); err != nil {
+			return fmt.Errorf("failed to set proxy: %w", err)
+		}
+		fmt.Println("Proxy set successfully!")
+		return nil
+	},
+}
+
+// proxy unset 命令
+var proxyUnsetCmd = &cobra.Command{
+	Use:   "unset",
+	Short: "Remove the global proxy.",
+	Args:  cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		if err := config.SetProxy(nil); err != nil {
+			return fmt.Errorf("failed to unset proxy: %w", err)
+		}
+		fmt.Println("Proxy removed successfully!")
+		return nil
+	},
+}
+
+// 解析用户输入的代理地址，URL 中的密码会被移除并加密保存，只有用户名时提示输入密码
+func parseProxyInput(rawURL string) (*config.Proxy, error) {
+	if rawURL == config.ProxyDirect {
+		return &config.Proxy{URL: config.ProxyDirect}, nil
+	}
+
+	proxyURL, err := utils.ParseProxyURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var password []byte
+	if proxyURL.User != nil {
+		if value, ok := proxyURL.User.Password(); ok {
+			password = []byte(value)
+		} else {
+			fmt.Printf("\nInput password of proxy user %s (enter to skip): ", proxyURL.User.Username())
+			password, err = term.ReadPassword(0)
+			if err != nil {
+				return nil, fmt.Errorf("error reading password: %w", err)
+			}
+			fmt.Println()
+		}
+		// 只保留用户名
+		proxyURL.User = url.User(proxyURL.User.Username())
+	}
+
+	p := &config.Proxy{URL: proxyURL.String()}
+	if p.Password, err = encryptSecret(password); err != nil {
+		return nil, fmt.Errorf("failed to encrypt proxy password: %w", err)
+	}
+	return p, nil
+}
+
+// 获取节点使用的代理拨号器，不使用代理时返回 nil
+func proxyDialer(node config.Node) (proxy.Dialer, error) {
+	p := config.GlobalNode.Proxy
+	if node.Proxy != nil {
+		p = node.Proxy
+	}
+	if p == nil || p.URL == config.ProxyDirect {
+		return nil, nil
+	}
+
+	var password string
+	if p.Password != "" {
+		var err error
+		password, err = decryptSecret(p.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt proxy password: %w", err)
+		}
+	}
+	return utils.NewProxyDialer(p.URL, password, 10*time.Second)
+}
+
+// 通过代理建立 SSH 连接
+func dialProxy(dialer proxy.Dialer, address string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect through proxy: %w", err)
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, address, clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+	proxyCmd.AddCommand(proxySetCmd)
+	proxyCmd.AddCommand(proxyUnsetCmd)
+}
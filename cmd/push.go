@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sshe/config"
+	"time"
+)
+
+var (
+	backup    bool // 是否在覆盖前备份远程文件
+	localMode bool // 是否使用本地文件的权限，默认保留远程文件原来的权限
+)
+
+// 推送到单个节点的结果
+type pushResult struct {
+	Node     string
+	Backup   string // 备份文件路径，没有备份时为空
+	Error    error
+	Duration time.Duration
+}
+
+// push 命令
+var pushCmd = &cobra.Command{
+	Use:   "push [filters] <local> <remote-path>",
+	Short: "Upload a file to all nodes matching the filters.",
+	Long: `Upload a file concurrently to all nodes matching the filters, using the same filter flags as list.
+The file is uploaded to a temporary file, verified with a SHA-256 checksum and then renamed over the target. Use --backup to keep the previous remote file.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		localPath, remotePath := args[0], args[1]
+
+		if !hasFilters() && !allNodes {
+			return errors.New("no filter specified, use --all to push to every node")
+		}
+		if workers < 1 {
+			return errors.New("--workers must be at least 1")
+		}
+
+		// 计算本地文件的校验值
+		info, err := os.Stat(localPath)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", localPath)
+		}
+		checksum, err := localChecksum(localPath)
+		if err != nil {
+			return err
+		}
+
+		nodes := filterNodes()
+		if len(nodes) == 0 {
+			fmt.Println("No matching nodes found.")
+			return nil
+		}
+		if err := unlockVaultIfNeeded(); err != nil {
+			return err
+		}
+
+		results := make([]pushResult, len(nodes))
+		fanOut(nodes, workers, func(i int, node config.Node) {
+			start := time.Now()
+			backupPath, err := pushToNode(node, localPath, remotePath, checksum)
+			results[i] = pushResult{Node: nodeLabel(node), Backup: backupPath, Error: err, Duration: time.Since(start)}
+		})
+
+		// 有节点失败时以非零状态退出，失败信息已经输出
+		if failed := printPushReport(results); failed > 0 {
+			cmd.SilenceErrors = true
+			return &exitCodeError{code: 1}
+		}
+		return nil
+	},
+}
+
+// 计算本地文件的 SHA-256
+func localChecksum(localPath string) ([]byte, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// 上传文件到节点并校验，返回备份文件路径，超过 hostTimeout 时中断，超时包括连接和认证
+func pushToNode(node config.Node, localPath, remotePath string, checksum []byte) (string, error) {
+	var backupPath string
+	err := withNodeClient(node, func(client *ssh.Client) error {
+		sftpClient, err := newSFTPClient(client)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = sftpClient.Close()
+		}()
+		backupPath, err = pushFile(sftpClient, localPath, remotePath, checksum)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// 上传到临时文件并校验，再替换目标文件，替换成功前原文件保持不变
+func pushFile(client *sftp.Client, localPath, remotePath string, checksum []byte) (string, error) {
+	if isRemoteDir(client, remotePath) {
+		remotePath = path.Join(remotePath, filepath.Base(localPath))
+	}
+	existing, statErr := client.Stat(remotePath)
+	exists := statErr == nil
+
+	// 临时文件名带随机后缀，避免多个用户同时推送到同一主机时冲突
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	tmpPath := fmt.Sprintf("%s.sshe-%x", remotePath, suffix)
+	if err := upload(client, localPath, tmpPath, transferOptions{}); err != nil {
+		_ = client.Remove(tmpPath)
+		return "", err
+	}
+
+	// 读取上传后的文件进行校验
+	remoteSum, err := remoteChecksum(client, tmpPath)
+	if err != nil {
+		_ = client.Remove(tmpPath)
+		return "", err
+	}
+	if !bytes.Equal(remoteSum, checksum) {
+		_ = client.Remove(tmpPath)
+		return "", errors.New("checksum mismatch after upload")
+	}
+
+	// 默认保留原文件的权限
+	if exists && !localMode {
+		if err := client.Chmod(tmpPath, existing.Mode().Perm()); err != nil {
+			_ = client.Remove(tmpPath)
+			return "", fmt.Errorf("failed to keep permissions of %s: %w", remotePath, err)
+		}
+	}
+
+	// 在服务端备份原文件，原文件保持不动
+	var backupPath string
+	if backup && exists {
+		backupPath = fmt.Sprintf("%s.%s.bak", remotePath, time.Now().Format("20060102150405"))
+		if err := backupRemote(client, remotePath, backupPath, existing.Mode().Perm()); err != nil {
+			_ = client.Remove(tmpPath)
+			return "", fmt.Errorf("failed to back up %s: %w", remotePath, err)
+		}
+	}
+
+	if err := replaceRemote(client, tmpPath, remotePath, exists); err != nil {
+		// 原文件没有被修改，备份也不再需要
+		_ = client.Remove(tmpPath)
+		if backupPath != "" {
+			_ = client.Remove(backupPath)
+		}
+		return "", fmt.Errorf("failed to replace %s: %w", remotePath, err)
+	}
+	return backupPath, nil
+}
+
+// 备份远程文件，优先创建硬链接，服务端不支持时复制一份
+func backupRemote(client *sftp.Client, remotePath, backupPath string, mode os.FileMode) error {
+	if _, ok := client.HasExtension("hardlink@openssh.com"); ok {
+		if err := client.Link(remotePath, backupPath); err == nil {
+			return nil
+		}
+	}
+
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	dst, err := client.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = client.Chmod(backupPath, mode)
+	}
+	if err != nil {
+		_ = client.Remove(backupPath)
+	}
+	return err
+}
+
+// 用临时文件替换目标文件，服务端支持时原子替换，否则先移开原文件，失败时移回
+func replaceRemote(client *sftp.Client, tmpPath, remotePath string, exists bool) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(tmpPath, remotePath)
+	}
+	if !exists {
+		return client.Rename(tmpPath, remotePath)
+	}
+
+	oldPath := tmpPath + ".old"
+	if err := client.Rename(remotePath, oldPath); err != nil {
+		return err
+	}
+	if err := client.Rename(tmpPath, remotePath); err != nil {
+		_ = client.Rename(oldPath, remotePath)
+		return err
+	}
+	_ = client.Remove(oldPath)
+	return nil
+}
+
+// 计算远程文件的 SHA-256
+func remoteChecksum(client *sftp.Client, remotePath string) ([]byte, error) {
+	file, err := client.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", remotePath, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", remotePath, err)
+	}
+	return hash.Sum(nil), nil
+}
+
+// 打印每个节点的推送结果，返回失败的节点数
+func printPushReport(results []pushResult) int {
+	rows := make([]summaryRow, len(results))
+	for i, result := range results {
+		detail := "verified"
+		if result.Backup != "" {
+			detail += ", backup: " + result.Backup
+		}
+		if result.Error != nil {
+			detail = result.Error.Error()
+		}
+		rows[i] = summaryRow{Node: result.Node, Failed: result.Error != nil, Duration: result.Duration, Detail: detail}
+	}
+	return printSummary(nil, "Detail", rows)
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+
+	addFilterFlags(pushCmd)
+	pushCmd.Flags().BoolVarP(&allNodes, "all", "", false, "Push to every node when no filter is specified.")
+	pushCmd.Flags().IntVarP(&workers, "workers", "w", 10, "Maximum number of nodes to push to concurrently.")
+	pushCmd.Flags().DurationVarP(&hostTimeout, "timeout", "", time.Minute, "Timeout for each node, 0 means no timeout.")
+	pushCmd.Flags().BoolVarP(&backup, "backup", "b", false, "Keep a copy of the existing remote file as <path>.<timestamp>.bak before replacing it.")
+	pushCmd.Flags().BoolVarP(&localMode, "local-mode", "", false, "Use the permissions of the local file instead of keeping those of the existing remote file.")
+	pushCmd.Flags().StringVarP(&hostKeyPolicyFlag, "host-key-policy", "", "", "Override the host key policy: strict, tofu or insecure.")
+}
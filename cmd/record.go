@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"path/filepath"
+	"sshe/config"
+	"sshe/utils"
+	"strings"
+	"time"
+)
+
+var (
+	recordSession bool // 是否录制会话输出
+	recordInput   bool // 是否同时录制输入
+)
+
+// 按需开始录制节点会话，返回录制器和文件路径，未开启录制时返回 nil
+func startRecording(node config.Node) (*utils.CastRecorder, string, error) {
+	if !recordSession && !recordInput {
+		return nil, "", nil
+	}
+
+	dir := filepath.Join(config.RecordingsPath, recordingDirName(node))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, "", fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	path := filepath.Join(dir, time.Now().Format("20060102-150405")+".cast")
+
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	recorder, err := utils.NewCastRecorder(path, utils.CastHeader{
+		Width:  width,
+		Height: height,
+		Title:  node.ID(),
+		Env:    map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create recording: %w", err)
+	}
+	return recorder, path, nil
+}
+
+// 录制目录名使用节点标识，替换不适合作为文件名的字符
+func recordingDirName(node config.Node) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._@-", r) {
+			return r
+		}
+		return '_'
+	}, node.ID())
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"sshe/agent"
+	"sshe/config"
+	"sshe/utils"
+)
+
+var (
+	newSecretKey string
+	keepSecret   bool
+)
+
+// rekey 命令
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Rotate the vault secret and re-encrypt every node.",
+	Long: `Decrypt every stored node with the current key and re-encrypt it with a new key derived from a fresh salt.
+In secret_key mode a new random secret_key is generated unless --secret-key is given; in master password mode a new master password is prompted.
+Use --keep to keep the current secret and only upgrade the salt and cipher version. Nothing is changed if any entry fails to decrypt.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		if keepSecret && newSecretKey != "" {
+			return errors.New("--keep and --secret-key cannot be used together")
+		}
+		if config.GlobalConfig.MasterPassword && newSecretKey != "" {
+			return errors.New("the vault is protected by a master password, use `sshe passwd` or omit --secret-key")
+		}
+
+		// 使用当前密钥解锁，旧版密文也需要重新加密
+		oldKey, err := unlockLegacyVault()
+		if err != nil {
+			return err
+		}
+
+		// 确定新的秘钥串
+		conf := config.GlobalConfig
+		var secret string
+		switch {
+		case keepSecret && conf.MasterPassword:
+			// 密钥可能来自 agent，需要重新输入主密码，并校验后再使用
+			password, err := readSecret("Master password: ")
+			if err != nil {
+				return err
+			}
+			if err := checkMasterPassword(string(password)); err != nil {
+				return err
+			}
+			secret = string(password)
+		case keepSecret:
+			secret = conf.SecretKey
+		case conf.MasterPassword:
+			secret, err = readNewMasterPassword()
+			if err != nil {
+				return err
+			}
+		case newSecretKey != "":
+			secret = newSecretKey
+		default:
+			secret, err = randomSecretKey()
+			if err != nil {
+				return err
+			}
+		}
+		if !conf.MasterPassword {
+			conf.SecretKey = secret
+		}
+
+		// 统计旧版密文数量
+		legacyCount := 0
+		for _, secret := range config.GlobalNode.Secrets() {
+			if utils.IsLegacyCipher(*secret) {
+				legacyCount++
+			}
+		}
+
+		if err := rekeyVault(oldKey, secret, conf); err != nil {
+			return err
+		}
+
+		fmt.Printf("Vault has been re-encrypted successfully! (%d nodes, %d legacy entries upgraded)\n", len(config.GlobalNode.Nodes), legacyCount)
+		return nil
+	},
+}
+
+// 使用新的秘钥串重新加密保险库，并原子地写回节点文件和配置文件
+func rekeyVault(oldKey *utils.VaultKey, secret string, conf config.Config) error {
+	// 生成新的盐值并派生密钥
+	salt, err := utils.NewSalt()
+	if err != nil {
+		return err
+	}
+	newKey, err := utils.DeriveVaultKey(secret, salt)
+	if err != nil {
+		return err
+	}
+
+	// 在副本上重新加密所有字段，任意一条失败则不做任何修改
+	nodes := config.GlobalNode.Clone()
+	if err := reencryptVault(&nodes, oldKey, newKey); err != nil {
+		return fmt.Errorf("rekey aborted, nothing was changed: %w", err)
+	}
+	nodes.Salt = base64.StdEncoding.EncodeToString(salt)
+	nodes.Verifier, err = utils.NewVerifier(newKey)
+	if err != nil {
+		return fmt.Errorf("failed to create verifier: %w", err)
+	}
+
+	if err := config.SaveVault(nodes, conf); err != nil {
+		return err
+	}
+	setVaultKey(newKey)
+	if conf.MasterPassword {
+		cacheVaultKey(newKey)
+	} else {
+		_ = agent.Lock()
+	}
+	warnSecretBackups()
+	return nil
+}
+
+// 提示仍然保存着旧密钥或旧密文的备份文件，旧密钥可以解密其中的数据
+func warnSecretBackups() {
+	backups, err := config.SecretBackups()
+	if err != nil || len(backups) == 0 {
+		return
+	}
+	fmt.Println("The following backups still hold secrets readable with the old key, delete them if they are no longer needed:")
+	for _, backup := range backups {
+		fmt.Printf("  %s\n", backup)
+	}
+}
+
+// 输入并确认新的主密码
+func readNewMasterPassword() (string, error) {
+	password, err := readSecret("New master password: ")
+	if err != nil {
+		return "", err
+	}
+	if len(password) == 0 {
+		return "", errors.New("the master password cannot be empty")
+	}
+	confirm, err := readSecret("Confirm master password: ")
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(confirm) {
+		return "", errors.New("the two passwords do not match")
+	}
+	return string(password), nil
+}
+
+// 生成随机秘钥串
+func randomSecretKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate secret key: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func init() {
+	rootCmd.AddCommand(rekeyCmd)
+
+	rekeyCmd.Flags().StringVarP(&newSecretKey, "secret-key", "", "", "Use the given secret_key instead of a random one.")
+	rekeyCmd.Flags().BoolVarP(&keepSecret, "keep", "", false, "Keep the current secret and only refresh the salt and cipher version.")
+}
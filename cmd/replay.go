@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"sshe/utils"
+	"time"
+)
+
+var (
+	replaySpeed float64       // 回放速度倍数
+	maxIdle     time.Duration // 回放时最长的停顿时间
+)
+
+// replay 命令
+var replayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Play back a recorded session.",
+	Long:  `Play back a session recorded by link --record. Recordings are stored under ~/.sshe/recordings/<node>/.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		if replaySpeed <= 0 {
+			return errors.New("--speed must be greater than 0")
+		}
+
+		file, err := os.Open(expandHome(args[0]))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		reader, err := utils.NewCastReader(file)
+		if err != nil {
+			return err
+		}
+		return replay(reader)
+	},
+}
+
+// 按录制时的时间间隔输出事件
+func replay(reader *utils.CastReader) error {
+	var last float64
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 只回放输出，输入已经体现在远程的回显中
+		if event.Type != "o" {
+			continue
+		}
+
+		delay := time.Duration((event.Time - last) / replaySpeed * float64(time.Second))
+		if maxIdle > 0 && delay > maxIdle {
+			delay = maxIdle
+		}
+		time.Sleep(delay)
+		last = event.Time
+
+		if _, err := fmt.Fprint(os.Stdout, event.Data); err != nil {
+			return err
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().Float64VarP(&replaySpeed, "speed", "s", 1, "Playback speed multiplier, e.g. 2 plays twice as fast.")
+	replayCmd.Flags().DurationVarP(&maxIdle, "max-idle", "", 0, "Limit pauses between outputs to this duration, e.g. 2s.")
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
 	"os"
@@ -14,6 +15,14 @@ var rootCmd = &cobra.Command{
 	Use:   "sshe",
 	Short: "Simple SSH management tool",
 	Long:  `SSHE is a simple tool used to manage and connect to the SSH password information of remote machines, providing basic functions such as adding, deleting, querying and connecting.`,
+	// 执行命令前读取配置文件，migrate 命令自己处理节点文件的迁移
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		config.AutoMigrate = cmd != migrateCmd
+		if err := config.LoadConfig(); err != nil {
+			fmt.Println("加载配置失败:", err)
+			os.Exit(1)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		_ = cmd.Help()
 	},
@@ -24,17 +33,21 @@ func Execute() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 
 	if err := rootCmd.Execute(); err != nil {
+		// 远程命令的退出码直接作为 sshe 的退出码
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
-// 初始化根命令
-func init() {
-	// 读取配置文件
-	err := config.LoadConfig()
-	if err != nil {
-		fmt.Println("加载配置失败:", err)
-		os.Exit(1)
-	}
+// 需要以指定退出码退出的错误
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
 }
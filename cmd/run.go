@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"os"
+	"sshe/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	allNodes    bool          // 不设置筛选条件时是否在所有节点上执行
+	workers     int           // 同时执行的节点数
+	hostTimeout time.Duration // 每个节点的超时时间
+	jsonOutput  bool          // 是否以 JSON 格式输出每个节点的结果
+)
+
+// 在单个节点上执行的结果
+type runResult struct {
+	Node       string `json:"node"`
+	Address    string `json:"address"`
+	Username   string `json:"username"`
+	ExitCode   int    `json:"exit_code"` // 未获取到退出码时为 -1
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// run 命令
+var runCmd = &cobra.Command{
+	Use:   "run [filters] -- <command...>",
+	Short: "Run a command on all nodes matching the filters.",
+	Long: `Run a command concurrently on all nodes matching the filters, using the same filter flags as list.
+Output lines are prefixed with the node, and a summary table is printed at the end. Use --json to print one JSON object per node instead.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		if !hasFilters() && !allNodes {
+			return errors.New("no filter specified, use --all to run on every node")
+		}
+		if workers < 1 {
+			return errors.New("--workers must be at least 1")
+		}
+
+		nodes := filterNodes()
+		if len(nodes) == 0 {
+			fmt.Println("No matching nodes found.")
+			return nil
+		}
+
+		if err := unlockVaultIfNeeded(); err != nil {
+			return err
+		}
+
+		command := strings.Join(args, " ")
+		results := make([]runResult, len(nodes))
+		var outputMu sync.Mutex
+		fanOut(nodes, workers, func(i int, node config.Node) {
+			results[i] = runOnNode(node, command, &outputMu)
+			if jsonOutput {
+				outputMu.Lock()
+				defer outputMu.Unlock()
+				data, _ := json.Marshal(results[i])
+				fmt.Println(string(data))
+			}
+		})
+
+		failed := 0
+		for _, result := range results {
+			if result.ExitCode != 0 {
+				failed++
+			}
+		}
+		if !jsonOutput {
+			printRunSummary(results)
+		}
+
+		// 有节点失败时以非零状态退出，失败信息已经输出
+		if failed > 0 {
+			cmd.SilenceErrors = true
+			return &exitCodeError{code: 1}
+		}
+		return nil
+	},
+}
+
+// 使用 workers 个协程并发处理节点
+func fanOut(nodes []config.Node, workers int, fn func(i int, node config.Node)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, node := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, node config.Node) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i, node)
+		}(i, node)
+	}
+	wg.Wait()
+}
+
+// 节点的显示名称，有别名时使用别名
+func nodeLabel(node config.Node) string {
+	if node.Alias != "" {
+		return node.Alias
+	}
+	return node.ID()
+}
+
+// 在节点上执行命令，超时后关闭连接
+func runOnNode(node config.Node, command string, outputMu *sync.Mutex) runResult {
+	result := runResult{
+		Node:     nodeLabel(node),
+		Address:  node.HostPort(),
+		Username: node.Username,
+		ExitCode: -1,
+	}
+	start := time.Now()
+
+	var stdout, stderr bytes.Buffer
+	var stdoutWriter, stderrWriter io.Writer = &stdout, &stderr
+	if !jsonOutput {
+		// 实时输出带节点前缀的每一行
+		prefix := "[" + result.Node + "] "
+		outWriter := &prefixWriter{mu: outputMu, out: os.Stdout, prefix: prefix}
+		errWriter := &prefixWriter{mu: outputMu, out: os.Stderr, prefix: prefix}
+		stdoutWriter, stderrWriter = outWriter, errWriter
+		defer outWriter.Flush()
+		defer errWriter.Flush()
+	}
+
+	exitCode, err := runWithTimeout(node, command, stdoutWriter, stderrWriter)
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.ExitCode = exitCode
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// 连接节点并执行命令，返回远程命令的退出码，超过 hostTimeout 时中断
+func runWithTimeout(node config.Node, command string, stdout, stderr io.Writer) (int, error) {
+	exitCode := -1
+	err := withNodeClient(node, func(client *ssh.Client) error {
+		session, err := client.NewSession()
+		if err != nil {
+			return fmt.Errorf("failed to create SSH session: %w", err)
+		}
+		session.Stdout = stdout
+		session.Stderr = stderr
+
+		err = session.Run(command)
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitStatus()
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to run command: %w", err)
+		}
+		exitCode = 0
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return exitCode, nil
+}
+
+// 连接节点并在连接上执行 fn，连接、认证和 fn 的总时间超过 hostTimeout 时关闭连接并返回超时错误
+// 超时返回后 fn 可能仍在运行，直到因连接关闭而出错，调用方只能在返回 nil 时使用 fn 写入的结果
+func withNodeClient(node config.Node, fn func(client *ssh.Client) error) error {
+	var deadline <-chan time.Time
+	if hostTimeout > 0 {
+		timer := time.NewTimer(hostTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	type dialResult struct {
+		client *ssh.Client
+		err    error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		client, err := dialNode(node)
+		dialed <- dialResult{client, err}
+	}()
+
+	var client *ssh.Client
+	select {
+	case r := <-dialed:
+		if r.err != nil {
+			return r.err
+		}
+		client = r.client
+	case <-deadline:
+		// 连接建立后立即关闭
+		go func() {
+			if r := <-dialed; r.client != nil {
+				_ = r.client.Close()
+			}
+		}()
+		return fmt.Errorf("timed out after %s", hostTimeout)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(client)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-deadline:
+		// 关闭连接以中断 fn
+		_ = client.Close()
+		return fmt.Errorf("timed out after %s", hostTimeout)
+	}
+}
+
+// 打印执行结果汇总表
+func printRunSummary(results []runResult) {
+	rows := make([]summaryRow, len(results))
+	for i, result := range results {
+		exitCode := "-"
+		if result.ExitCode >= 0 {
+			exitCode = fmt.Sprint(result.ExitCode)
+		}
+		rows[i] = summaryRow{
+			Node:     result.Node,
+			Failed:   result.ExitCode != 0,
+			Columns:  []string{exitCode},
+			Duration: time.Duration(result.DurationMs) * time.Millisecond,
+			Detail:   result.Error,
+		}
+	}
+	fmt.Println()
+	printSummary([]string{"Exit"}, "Error", rows)
+}
+
+// 汇总表中一个节点的结果
+type summaryRow struct {
+	Node     string
+	Failed   bool
+	Columns  []string // Status 和 Duration 之间的附加列
+	Duration time.Duration
+	Detail   string
+}
+
+// 打印各节点结果的汇总表和成功、失败的数量，columns 为附加列的标题，返回失败的节点数
+func printSummary(columns []string, detailTitle string, rows []summaryRow) int {
+	header := append(append([]string{"Node", "Status"}, columns...), "Duration", detailTitle)
+	lines := [][]string{header}
+	failed := 0
+	for _, row := range rows {
+		status := "OK"
+		if row.Failed {
+			status = "FAILED"
+			failed++
+		}
+		line := append(append([]string{row.Node, status}, row.Columns...), row.Duration.Round(10*time.Millisecond).String(), row.Detail)
+		lines = append(lines, line)
+	}
+
+	// 最后一列不需要对齐
+	widths := make([]int, len(header)-1)
+	for _, line := range lines {
+		for i := range widths {
+			widths[i] = max(widths[i], len(line[i]))
+		}
+	}
+	for _, line := range lines {
+		var builder strings.Builder
+		for i, width := range widths {
+			builder.WriteString(fmt.Sprintf("%-*s ", width, line[i]))
+		}
+		builder.WriteString(line[len(line)-1])
+		fmt.Println(strings.TrimRight(builder.String(), " "))
+	}
+	fmt.Printf("\n%d succeeded, %d failed.\n", len(rows)-failed, failed)
+	return failed
+}
+
+// 按行输出并在每行前加上前缀的 Writer，多个节点共享同一个锁避免输出交错
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush 输出最后一行不完整的内容
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, _ = fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	addFilterFlags(runCmd)
+	runCmd.Flags().BoolVarP(&allNodes, "all", "", false, "Run on every node when no filter is specified.")
+	runCmd.Flags().IntVarP(&workers, "workers", "w", 10, "Maximum number of nodes to run on concurrently.")
+	runCmd.Flags().DurationVarP(&hostTimeout, "timeout", "", time.Minute, "Timeout for each node, 0 means no timeout.")
+	runCmd.Flags().BoolVarP(&jsonOutput, "json", "", false, "Print the result of each node as a JSON object.")
+	runCmd.Flags().StringVarP(&hostKeyPolicyFlag, "host-key-policy", "", "", "Override the host key policy: strict, tofu or insecure.")
+}
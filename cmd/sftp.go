@@ -0,0 +1,453 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sftp 命令
+var sftpCmd = &cobra.Command{
+	Use:   "sftp <host[:port]>",
+	Short: "Open an interactive SFTP shell on a matching node.",
+	Long:  `Open an interactive SFTP shell on a matching node. Type help in the shell to list the available commands; remote and local paths can be completed with Tab.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		address := args[0]
+
+		// 查找并选择节点
+		node, err := resolveNode(address)
+		if err != nil {
+			return err
+		}
+
+		client, sftpClient, err := openSFTP(node)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = sftpClient.Close()
+			_ = client.Close()
+		}()
+
+		shell, err := newSFTPShell(sftpClient)
+		if err != nil {
+			return err
+		}
+		return shell.run()
+	},
+}
+
+// sftp 交互命令的说明
+var sftpCommands = [][2]string{
+	{"ls [-l] [path]", "List a remote directory"},
+	{"cd [path]", "Change the remote directory"},
+	{"pwd", "Print the remote directory"},
+	{"get [-r] [-p] <remote> [local]", "Download a file or directory"},
+	{"put [-r] [-p] <local> [remote]", "Upload a file or directory"},
+	{"mkdir <path>", "Create a remote directory"},
+	{"rm <path>", "Remove a remote file"},
+	{"rmdir <path>", "Remove an empty remote directory"},
+	{"lls [path]", "List a local directory"},
+	{"lcd <path>", "Change the local directory"},
+	{"lpwd", "Print the local directory"},
+	{"help", "Show this help"},
+	{"exit", "Quit the shell"},
+}
+
+// 交互式 SFTP 会话
+type sftpShell struct {
+	client *sftp.Client
+	home   string    // 登录时的远程目录
+	cwd    string    // 远程当前目录
+	out    io.Writer // 输出，终端模式下会将 \n 转换为 \r\n
+	term   *term.Terminal
+}
+
+func newSFTPShell(client *sftp.Client) (*sftpShell, error) {
+	cwd, err := client.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote directory: %w", err)
+	}
+	return &sftpShell{client: client, home: cwd, cwd: cwd, out: os.Stdout}, nil
+}
+
+// 读取并执行命令，直到退出或输入结束
+func (s *sftpShell) run() error {
+	readLine := s.lineReader()
+	if s.term != nil {
+		fd := int(os.Stdin.Fd())
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to set terminal to raw mode: %w", err)
+		}
+		defer func() {
+			_ = term.Restore(fd, oldState)
+		}()
+	}
+
+	for {
+		line, err := readLine()
+		if err == io.EOF {
+			fmt.Fprintln(s.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args := splitArgs(line)
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" || args[0] == "bye" {
+			return nil
+		}
+		if err := s.exec(args); err != nil {
+			fmt.Fprintf(s.out, "%s: %v\n", args[0], err)
+		}
+	}
+}
+
+// 标准输入是终端时使用支持补全的行编辑器，否则逐行读取
+func (s *sftpShell) lineReader() func() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		scanner := bufio.NewScanner(os.Stdin)
+		return func() (string, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return scanner.Text(), nil
+		}
+	}
+
+	s.term = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "sftp> ")
+	s.term.AutoCompleteCallback = s.complete
+	if width, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		_ = s.term.SetSize(width, height)
+	}
+	s.out = s.term
+	return s.term.ReadLine
+}
+
+// 执行一条命令
+func (s *sftpShell) exec(args []string) error {
+	switch args[0] {
+	case "help", "?":
+		for _, c := range sftpCommands {
+			fmt.Fprintf(s.out, "%-32s %s\n", c[0], c[1])
+		}
+	case "pwd":
+		fmt.Fprintln(s.out, s.cwd)
+	case "lpwd":
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, cwd)
+	case "cd":
+		// 不指定路径时回到登录时的目录
+		target := s.home
+		if len(args) > 1 {
+			target = s.remotePath(args[1])
+		}
+		if !isRemoteDir(s.client, target) {
+			return fmt.Errorf("%s is not a directory", target)
+		}
+		s.cwd = target
+	case "lcd":
+		if len(args) < 2 {
+			return errors.New("missing path")
+		}
+		return os.Chdir(expandHome(args[1]))
+	case "ls":
+		flags, paths := parseFlags(args[1:], "l")
+		target := s.cwd
+		if len(paths) > 0 {
+			target = s.remotePath(paths[0])
+		}
+		entries, err := s.client.ReadDir(target)
+		if err != nil {
+			return err
+		}
+		s.printEntries(entries, flags["l"])
+	case "lls":
+		target := "."
+		if len(args) > 1 {
+			target = expandHome(args[1])
+		}
+		dirEntries, err := os.ReadDir(target)
+		if err != nil {
+			return err
+		}
+		var entries []os.FileInfo
+		for _, entry := range dirEntries {
+			if info, err := entry.Info(); err == nil {
+				entries = append(entries, info)
+			}
+		}
+		s.printEntries(entries, false)
+	case "get":
+		flags, paths := parseFlags(args[1:], "rp")
+		if len(paths) == 0 {
+			return errors.New("missing remote path")
+		}
+		remotePath := s.remotePath(paths[0])
+		localPath := path.Base(remotePath)
+		if len(paths) > 1 {
+			localPath = expandHome(paths[1])
+			if isLocalDir(localPath) {
+				localPath = filepath.Join(localPath, path.Base(remotePath))
+			}
+		}
+		return download(s.client, remotePath, localPath, s.transferOptions(flags))
+	case "put":
+		flags, paths := parseFlags(args[1:], "rp")
+		if len(paths) == 0 {
+			return errors.New("missing local path")
+		}
+		localPath := expandHome(paths[0])
+		remotePath := s.remotePath(filepath.Base(localPath))
+		if len(paths) > 1 {
+			remotePath = s.remotePath(paths[1])
+			if isRemoteDir(s.client, remotePath) {
+				remotePath = path.Join(remotePath, filepath.Base(localPath))
+			}
+		}
+		return upload(s.client, localPath, remotePath, s.transferOptions(flags))
+	case "mkdir":
+		if len(args) < 2 {
+			return errors.New("missing path")
+		}
+		return s.client.Mkdir(s.remotePath(args[1]))
+	case "rm":
+		if len(args) < 2 {
+			return errors.New("missing path")
+		}
+		return s.client.Remove(s.remotePath(args[1]))
+	case "rmdir":
+		if len(args) < 2 {
+			return errors.New("missing path")
+		}
+		return s.client.RemoveDirectory(s.remotePath(args[1]))
+	default:
+		return errors.New("unknown command, type help to list the commands")
+	}
+	return nil
+}
+
+// 传输选项，终端模式下显示进度
+func (s *sftpShell) transferOptions(flags map[string]bool) transferOptions {
+	opts := transferOptions{recursive: flags["r"], preserve: flags["p"]}
+	if s.term != nil {
+		opts.progress = s.out
+	}
+	return opts
+}
+
+// 输出目录内容，目录名以 / 结尾
+func (s *sftpShell) printEntries(entries []os.FileInfo, long bool) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		if long {
+			fmt.Fprintf(s.out, "%s %10d %s %s\n", entry.Mode(), entry.Size(), entry.ModTime().Format("2006-01-02 15:04"), name)
+		} else {
+			fmt.Fprintln(s.out, name)
+		}
+	}
+}
+
+// 将相对路径转换为基于远程当前目录的绝对路径
+func (s *sftpShell) remotePath(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(s.cwd, p)
+}
+
+// Tab 补全命令名和路径，put、lcd、lls 的第一个参数补全本地路径，其余补全远程路径
+func (s *sftpShell) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	// 只补全光标前的最后一个单词
+	start := strings.LastIndex(line[:pos], " ") + 1
+	word := line[start:pos]
+	fields := strings.Fields(line[:start])
+
+	var candidates []string
+	if len(fields) == 0 {
+		for _, c := range sftpCommands {
+			name, _, _ := strings.Cut(c[0], " ")
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name+" ")
+			}
+		}
+	} else {
+		local := fields[0] == "lcd" || fields[0] == "lls" || fields[0] == "put" && len(nonFlagArgs(fields[1:])) == 0
+		candidates = s.completePath(word, local)
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+
+	// 多个候选时补全公共前缀，无法继续补全时列出候选
+	completion := commonPrefix(candidates)
+	if completion == word && len(candidates) > 1 {
+		names := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			names[i] = path.Base(strings.TrimSuffix(candidate, "/"))
+			if strings.HasSuffix(candidate, "/") {
+				names[i] += "/"
+			}
+		}
+		fmt.Fprintln(s.out, strings.Join(names, "  "))
+		return "", 0, false
+	}
+	newLine := line[:start] + completion + line[pos:]
+	return newLine, start + len(completion), true
+}
+
+// 列出以 word 开头的路径，目录以 / 结尾
+func (s *sftpShell) completePath(word string, local bool) []string {
+	dir, prefix := "", word
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		dir, prefix = word[:i+1], word[i+1:]
+	}
+
+	var entries []os.FileInfo
+	if local {
+		listDir := dir
+		if listDir == "" {
+			listDir = "."
+		}
+		dirEntries, err := os.ReadDir(expandHome(listDir))
+		if err != nil {
+			return nil
+		}
+		for _, entry := range dirEntries {
+			if info, err := entry.Info(); err == nil {
+				entries = append(entries, info)
+			}
+		}
+	} else {
+		var err error
+		entries, err = s.client.ReadDir(s.remotePath(dir))
+		if err != nil {
+			return nil
+		}
+	}
+
+	var candidates []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		// 以 . 开头的文件只有在输入了 . 时才补全
+		if prefix == "" && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		candidate := dir + entry.Name()
+		if entry.IsDir() {
+			candidate += "/"
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// 求字符串的公共前缀
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// 拆分命令行，支持双引号和反斜杠转义空格
+func splitArgs(line string) []string {
+	var args []string
+	var current strings.Builder
+	inQuote, hasArg := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+			hasArg = true
+		case c == '"':
+			inQuote = !inQuote
+			hasArg = true
+		case c == ' ' && !inQuote:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteByte(c)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// 解析 -r、-p 这类单字母参数，返回设置的参数和其余参数
+func parseFlags(args []string, allowed string) (map[string]bool, []string) {
+	flags := map[string]bool{}
+	var rest []string
+	for _, arg := range args {
+		if len(arg) > 1 && strings.HasPrefix(arg, "-") && strings.Trim(arg[1:], allowed) == "" {
+			for _, c := range arg[1:] {
+				flags[string(c)] = true
+			}
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return flags, rest
+}
+
+// 去掉以 - 开头的参数
+func nonFlagArgs(args []string) []string {
+	_, rest := parseFlags(args, "rpl")
+	return rest
+}
+
+func init() {
+	rootCmd.AddCommand(sftpCmd)
+
+	sftpCmd.Flags().StringVarP(&user, "user", "u", "", "Specifies the username for connection.")
+	sftpCmd.Flags().StringVarP(&hostKeyPolicyFlag, "host-key-policy", "", "", "Override the host key policy: strict, tofu or insecure.")
+}
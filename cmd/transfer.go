@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sshe/config"
+	"time"
+)
+
+// 文件传输选项
+type transferOptions struct {
+	recursive bool      // 是否递归复制目录
+	preserve  bool      // 是否保留修改时间
+	progress  io.Writer // 进度输出，为 nil 时不显示进度
+}
+
+// 连接节点并在同一个 SSH 连接上打开 SFTP 客户端
+func openSFTP(node config.Node) (*ssh.Client, *sftp.Client, error) {
+	client, err := dialNode(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	sftpClient, err := newSFTPClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, nil, err
+	}
+	return client, sftpClient, nil
+}
+
+// 在已建立的 SSH 连接上打开 SFTP 客户端
+func newSFTPClient(client *ssh.Client) (*sftp.Client, error) {
+	sftpClient, err := sftp.NewClient(client, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	return sftpClient, nil
+}
+
+// 标准错误输出是终端时显示传输进度
+func progressOutput(quiet bool) io.Writer {
+	if quiet || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return os.Stderr
+}
+
+// 上传本地文件或目录到远程路径
+func upload(client *sftp.Client, localPath, remotePath string, opts transferOptions) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if !opts.recursive {
+			return fmt.Errorf("%s is a directory, use -r to copy directories", localPath)
+		}
+		if err := client.MkdirAll(remotePath); err != nil {
+			return fmt.Errorf("failed to create remote directory %s: %w", remotePath, err)
+		}
+		entries, err := os.ReadDir(localPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err := upload(client, filepath.Join(localPath, entry.Name()), path.Join(remotePath, entry.Name()), opts)
+			if err != nil {
+				return err
+			}
+		}
+		return preserveRemote(client, remotePath, info, opts)
+	}
+
+	if !info.Mode().IsRegular() {
+		fmt.Fprintf(os.Stderr, "Skipping %s: not a regular file\n", localPath)
+		return nil
+	}
+
+	local, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = local.Close()
+	}()
+
+	remote, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file %s: %w", remotePath, err)
+	}
+	reader := &progressReader{reader: local, progress: newTransferProgress(opts.progress, filepath.Base(localPath), info.Size())}
+	_, err = io.Copy(remote, reader)
+	reader.progress.finish()
+	if closeErr := remote.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", localPath, err)
+	}
+	return preserveRemote(client, remotePath, info, opts)
+}
+
+// 下载远程文件或目录到本地路径
+func download(client *sftp.Client, remotePath, localPath string, opts transferOptions) error {
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", remotePath, err)
+	}
+
+	if info.IsDir() {
+		if !opts.recursive {
+			return fmt.Errorf("%s is a directory, use -r to copy directories", remotePath)
+		}
+		if err := os.MkdirAll(localPath, 0755); err != nil {
+			return err
+		}
+		entries, err := client.ReadDir(remotePath)
+		if err != nil {
+			return fmt.Errorf("failed to read remote directory %s: %w", remotePath, err)
+		}
+		for _, entry := range entries {
+			err := download(client, path.Join(remotePath, entry.Name()), filepath.Join(localPath, entry.Name()), opts)
+			if err != nil {
+				return err
+			}
+		}
+		return preserveLocal(localPath, info, opts)
+	}
+
+	if !info.Mode().IsRegular() {
+		fmt.Fprintf(os.Stderr, "Skipping %s: not a regular file\n", remotePath)
+		return nil
+	}
+
+	remote, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to open remote file %s: %w", remotePath, err)
+	}
+	defer func() {
+		_ = remote.Close()
+	}()
+
+	local, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	writer := &progressWriter{writer: local, progress: newTransferProgress(opts.progress, path.Base(remotePath), info.Size())}
+	_, err = io.Copy(writer, remote)
+	writer.progress.finish()
+	if closeErr := local.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", remotePath, err)
+	}
+	return preserveLocal(localPath, info, opts)
+}
+
+// 设置远程文件的权限，需要时保留修改时间
+func preserveRemote(client *sftp.Client, remotePath string, info os.FileInfo, opts transferOptions) error {
+	if err := client.Chmod(remotePath, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", remotePath, err)
+	}
+	if opts.preserve {
+		if err := client.Chtimes(remotePath, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("failed to set modification time of %s: %w", remotePath, err)
+		}
+	}
+	return nil
+}
+
+// 设置本地文件的权限，需要时保留修改时间
+func preserveLocal(localPath string, info os.FileInfo, opts transferOptions) error {
+	if err := os.Chmod(localPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if opts.preserve {
+		if err := os.Chtimes(localPath, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 远程路径是否为已存在的目录
+func isRemoteDir(client *sftp.Client, remotePath string) bool {
+	info, err := client.Stat(remotePath)
+	return err == nil && info.IsDir()
+}
+
+// 本地路径是否为已存在的目录
+func isLocalDir(localPath string) bool {
+	info, err := os.Stat(localPath)
+	return err == nil && info.IsDir()
+}
+
+// 单个文件的传输进度
+type transferProgress struct {
+	out      io.Writer
+	name     string
+	total    int64
+	done     int64
+	start    time.Time
+	lastDraw time.Time
+}
+
+func newTransferProgress(out io.Writer, name string, total int64) *transferProgress {
+	return &transferProgress{out: out, name: name, total: total, start: time.Now()}
+}
+
+// 累加已传输的字节数，最多每 100ms 刷新一次
+func (p *transferProgress) add(n int) {
+	p.done += int64(n)
+	if p.out != nil && time.Since(p.lastDraw) >= 100*time.Millisecond {
+		p.draw()
+	}
+}
+
+// 输出最终进度并换行
+func (p *transferProgress) finish() {
+	if p.out == nil {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.out)
+}
+
+func (p *transferProgress) draw() {
+	p.lastDraw = time.Now()
+	percent := int64(100)
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+	speed := float64(p.done) / max(time.Since(p.start).Seconds(), 0.001)
+	fmt.Fprintf(p.out, "\r%-30s %3d%% %9s %9s/s", p.name, percent, formatBytes(float64(p.done)), formatBytes(speed))
+}
+
+// 格式化字节数
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f%s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
+
+// 统计读取进度的 Reader
+type progressReader struct {
+	reader   io.Reader
+	progress *transferProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.progress.add(n)
+	return n, err
+}
+
+// Size 返回文件大小，SFTP 客户端据此并发写入
+func (r *progressReader) Size() int64 {
+	return r.progress.total
+}
+
+// 统计写入进度的 Writer
+type progressWriter struct {
+	writer   io.Writer
+	progress *transferProgress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	w.progress.add(n)
+	return n, err
+}
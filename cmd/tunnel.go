@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log"
+	"os/signal"
+	"sshe/config"
+	"syscall"
+	"time"
+)
+
+// 重连的最大等待时间
+var maxBackoff time.Duration
+
+// tunnel 命令
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel <host[:port]>",
+	Short: "Keep port forwards to a node open without a shell.",
+	Long: `Keep port forwards to a node open without a shell. The node's saved forwards and the -L/-R/-D flags are set up without requesting a terminal.
+The connection is re-established with exponential backoff when it drops, logs are written to stderr, and SIGINT/SIGTERM stop the tunnel.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		address := args[0]
+
+		// 查找并选择节点
+		node, err := resolveNode(address)
+		if err != nil {
+			return err
+		}
+
+		if maxBackoff < time.Second {
+			return errors.New("--max-backoff must be at least 1s")
+		}
+
+		// 校验端口转发参数
+		rules, err := nodeForwards(node)
+		if err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return errors.New("no forwards specified, use -L, -R or -D or save them on the node")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		runTunnel(ctx, node, rules)
+		return nil
+	},
+}
+
+// 保持到节点的转发，连接断开时按指数退避重连，直到 ctx 结束
+func runTunnel(ctx context.Context, node config.Node, rules []forwardRule) {
+	backoff := time.Second
+	for {
+		err := serveTunnel(ctx, node, rules)
+		if ctx.Err() != nil {
+			log.Printf("Tunnel to %s stopped", node.ID())
+			return
+		}
+		if errors.Is(err, errConnectionLost) {
+			// 曾经连接成功，重新从最短的等待时间开始
+			backoff = time.Second
+		}
+		log.Printf("%v, reconnecting in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Tunnel to %s stopped", node.ID())
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// 建立一次连接和所有转发，阻塞到连接断开或 ctx 结束
+func serveTunnel(ctx context.Context, node config.Node, rules []forwardRule) error {
+	log.Printf("Connecting to %s", node.ID())
+	client, err := dialNode(node)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	forwards, err := startForwards(client, rules, log.Printf)
+	if err != nil {
+		return err
+	}
+	defer forwards.Close()
+	log.Printf("Connected to %s", node.ID())
+
+	// 心跳超时会关闭连接，触发重新连接
+	alive := startKeepalive(client, node)
+	defer alive.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-done:
+		return fmt.Errorf("%s: %w", node.ID(), errConnectionLost)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelCmd)
+
+	tunnelCmd.Flags().StringVarP(&user, "user", "u", "", "Specifies the username for connection.")
+	tunnelCmd.Flags().StringArrayVarP(&localForwards, "local-forward", "L", []string{}, "Forward a local port to a remote address: [bind:]port:host:hostport.")
+	tunnelCmd.Flags().StringArrayVarP(&remoteForwards, "remote-forward", "R", []string{}, "Forward a remote port to a local address: [bind:]port:host:hostport.")
+	tunnelCmd.Flags().StringArrayVarP(&dynamicForwards, "dynamic-forward", "D", []string{}, "Start a local SOCKS5 proxy tunneled through the node: [bind:]port.")
+	tunnelCmd.Flags().IntVarP(&keepaliveFlag, "keepalive", "", 0, "Send a keepalive every N seconds and reconnect after keepalive_count_max missed replies, -1 disables.")
+	tunnelCmd.Flags().DurationVarP(&maxBackoff, "max-backoff", "", time.Minute, "Maximum delay between reconnection attempts.")
+	tunnelCmd.Flags().StringVarP(&hostKeyPolicyFlag, "host-key-policy", "", "", "Override the host key policy: strict, tofu or insecure.")
+}
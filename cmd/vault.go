@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"sshe/agent"
+	"sshe/config"
+	"sshe/utils"
+	"sync"
+)
+
+var (
+	// 本次执行中已解锁的保险库密钥
+	vaultKey *utils.VaultKey
+	// 保护 vaultKey，并发连接时只提示一次主密码
+	vaultMu sync.Mutex
+)
+
+// 解锁保险库，每次执行最多提示一次主密码，可以被多个协程同时调用
+func unlockVault() (*utils.VaultKey, error) {
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+	if vaultKey != nil {
+		return vaultKey, nil
+	}
+
+	salt, err := config.VaultSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	// 主密码模式下优先使用 agent 缓存的密钥，否则提示输入
+	secret := config.GlobalConfig.SecretKey
+	if config.GlobalConfig.MasterPassword {
+		if config.GlobalNode.Verifier == "" {
+			return nil, errors.New("the vault has no master password verifier, run `sshe passwd` to set one")
+		}
+		if key := agentVaultKey(); key != nil {
+			vaultKey = key
+			return vaultKey, nil
+		}
+		password, err := readSecret("Master password: ")
+		if err != nil {
+			return nil, err
+		}
+		secret = string(password)
+	}
+
+	key, err := utils.DeriveVaultKey(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	// 校验密钥，避免使用错误的密钥继续操作
+	if config.GlobalNode.Verifier != "" && !utils.CheckVerifier(config.GlobalNode.Verifier, key) {
+		if config.GlobalConfig.MasterPassword {
+			return nil, errors.New("wrong master password")
+		}
+		return nil, errors.New("secret_key in sshe.conf does not match the vault")
+	}
+
+	if config.GlobalConfig.MasterPassword {
+		cacheVaultKey(key)
+	} else if config.GlobalNode.Verifier == "" {
+		// secret_key 模式下旧的保险库没有校验值，确认密钥正确后补上
+		if err := saveVerifier(key); err != nil {
+			fmt.Printf("Failed to save vault verifier: %v\n", err)
+		}
+	}
+	// 秘钥串已在内存中，有旧版密文时一并得到旧版密钥
+	if hasLegacyCipher() {
+		key = key.WithLegacySecret(secret)
+	}
+	vaultKey = key
+	return vaultKey, nil
+}
+
+// 保险库中还没有密文，或密钥可以解密已有的 v2 密文时写入密钥校验值，之后错误的密钥会在解锁时被拒绝
+func saveVerifier(key *utils.VaultKey) error {
+	matched := true
+	for _, secret := range config.GlobalNode.Secrets() {
+		if *secret == "" {
+			continue
+		}
+		matched = false
+		// 旧版密文没有认证，使用错误的密钥也可能解密成功，只根据 v2 密文判断
+		if !utils.IsLegacyCipher(*secret) {
+			if _, err := utils.DecryptAES(*secret, key); err == nil {
+				matched = true
+				break
+			}
+		}
+	}
+	if !matched {
+		return nil
+	}
+
+	verifier, err := utils.NewVerifier(key)
+	if err != nil {
+		return err
+	}
+	return config.UpdateNodes(func(nodes *config.NodesFile) error {
+		if nodes.Verifier == "" {
+			nodes.Verifier = verifier
+		}
+		return nil
+	})
+}
+
+// 解锁保险库，并确保可以解密旧版密文，密钥来自 agent 时需要重新输入主密码
+func unlockLegacyVault() (*utils.VaultKey, error) {
+	key, err := unlockVault()
+	if err != nil || key.HasLegacy() || !hasLegacyCipher() {
+		return key, err
+	}
+
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+	if vaultKey.HasLegacy() {
+		return vaultKey, nil
+	}
+	secret := config.GlobalConfig.SecretKey
+	if config.GlobalConfig.MasterPassword {
+		password, err := readSecret("Master password (required for legacy entries): ")
+		if err != nil {
+			return nil, err
+		}
+		if err := checkMasterPassword(string(password)); err != nil {
+			return nil, err
+		}
+		secret = string(password)
+	}
+	vaultKey = vaultKey.WithLegacySecret(secret)
+	return vaultKey, nil
+}
+
+// 使用当前的盐值派生密钥，校验主密码是否与保险库匹配
+func checkMasterPassword(password string) error {
+	salt, err := config.VaultSalt()
+	if err != nil {
+		return err
+	}
+	key, err := utils.DeriveVaultKey(password, salt)
+	if err != nil {
+		return err
+	}
+	if !utils.CheckVerifier(config.GlobalNode.Verifier, key) {
+		return errors.New("wrong master password")
+	}
+	return nil
+}
+
+// 保险库中是否有旧版格式的密文
+func hasLegacyCipher() bool {
+	for _, secret := range config.GlobalNode.Secrets() {
+		if utils.IsLegacyCipher(*secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// 替换已解锁的密钥
+func setVaultKey(key *utils.VaultKey) {
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+	vaultKey = key
+}
+
+// 保险库中有加密字段时提前解锁，并发连接多个节点前调用，避免多个协程同时提示输入
+func unlockVaultIfNeeded() error {
+	for _, secret := range config.GlobalNode.Secrets() {
+		if *secret != "" {
+			// 有旧版密文时一并得到旧版密钥，密钥来自 agent 时也只在这里提示
+			_, err := unlockLegacyVault()
+			return err
+		}
+	}
+	return nil
+}
+
+// 从 agent 获取缓存的密钥，agent 未运行、已锁定或密钥与保险库不匹配时返回 nil
+func agentVaultKey() *utils.VaultKey {
+	data, err := agent.GetKey()
+	if err != nil || data == nil {
+		return nil
+	}
+	key, err := utils.VaultKeyFromBytes(data)
+	if err != nil || !utils.CheckVerifier(config.GlobalNode.Verifier, key) {
+		return nil
+	}
+	return key
+}
+
+// 将密钥缓存到 agent，agent 未运行时忽略
+func cacheVaultKey(key *utils.VaultKey) {
+	err := agent.SetKey(key.Bytes())
+	if err != nil && !errors.Is(err, agent.ErrNotRunning) {
+		fmt.Printf("Failed to cache key in agent: %v\n", err)
+	}
+}
+
+// 加密需要保存到保险库的字段，内容为空时返回空字符串
+func encryptSecret(plainText []byte) (string, error) {
+	if len(plainText) == 0 {
+		return "", nil
+	}
+	key, err := unlockVault()
+	if err != nil {
+		return "", err
+	}
+	return utils.EncryptAES(plainText, key)
+}
+
+// 解密保险库中的字段，旧版密文需要旧版密钥
+func decryptSecret(cipherText string) (string, error) {
+	unlock := unlockVault
+	if utils.IsLegacyCipher(cipherText) {
+		unlock = unlockLegacyVault
+	}
+	key, err := unlock()
+	if err != nil {
+		return "", err
+	}
+	return utils.DecryptAES(cipherText, key)
+}
+
+// 读取不回显的敏感输入
+func readSecret(prompt string) ([]byte, error) {
+	fmt.Print(prompt)
+	var secret []byte
+	var err error
+	if stdin.active() {
+		// link 重新连接时标准输入已由读取协程接管，从中读取
+		secret, err = stdin.readPassword()
+	} else {
+		secret, err = term.ReadPassword(int(os.Stdin.Fd()))
+	}
+	// 换行以避免后续输出和提示混在一起
+	fmt.Println()
+	if err != nil {
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+	return secret, nil
+}
+
+// 使用新密钥重新加密保险库中的所有字段，任意一条解密失败则返回错误
+// 会直接修改传入的节点数据，调用方需传入副本
+func reencryptVault(nodes *config.NodesFile, oldKey, newKey *utils.VaultKey) error {
+	if nodes.Proxy != nil {
+		if err := reencryptSecret(&nodes.Proxy.Password, oldKey, newKey); err != nil {
+			return fmt.Errorf("failed to re-encrypt global proxy password: %w", err)
+		}
+	}
+	for i := range nodes.Nodes {
+		for _, secret := range nodes.Nodes[i].Secrets() {
+			if err := reencryptSecret(secret, oldKey, newKey); err != nil {
+				return fmt.Errorf("failed to re-encrypt secret of %s: %w", nodes.Nodes[i].ID(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// 使用新密钥重新加密单个字段
+func reencryptSecret(secret *string, oldKey, newKey *utils.VaultKey) error {
+	if *secret == "" {
+		return nil
+	}
+	plainText, err := utils.DecryptAES(*secret, oldKey)
+	if err != nil {
+		return err
+	}
+	cipherText, err := utils.EncryptAES([]byte(plainText), newKey)
+	if err != nil {
+		return err
+	}
+	*secret = cipherText
+	return nil
+}
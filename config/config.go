@@ -1,47 +1,208 @@
 package config
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"sshe/utils"
+	"strconv"
 )
 
 // Config 配置文件
 type Config struct {
-	SecretKey string `yaml:"secret_key"`
+	SecretKey        string `yaml:"secret_key,omitempty"`         // 加密秘钥串，启用主密码后不再保存
+	MasterPassword   bool   `yaml:"master_password,omitempty"`    // 是否使用运行时输入的主密码派生密钥
+	HostKeyPolicy    string `yaml:"host_key_policy,omitempty"`    // 全局主机密钥校验策略：strict/tofu/insecure
+	SystemKnownHosts bool   `yaml:"system_known_hosts,omitempty"` // 是否同时使用 ~/.ssh/known_hosts 校验
+
+	KeepaliveInterval int `yaml:"keepalive_interval,omitempty"`  // 心跳间隔（秒），为 0 时不发送心跳
+	KeepaliveCountMax int `yaml:"keepalive_count_max,omitempty"` // 连续多少次心跳未响应后断开连接，为 0 时使用 3
+
+	WriteTagIndex bool `yaml:"write_tag_index,omitempty"` // 是否在节点文件中写入标签索引，供旧版本和外部工具使用
 }
 
 // Node 节点
 type Node struct {
-	IP       string   `yaml:"ip"`
+	Alias    string   `yaml:"alias,omitempty"` // 节点别名
+	IP       string   `yaml:"ip,omitempty"`    // 节点 IP，通过域名访问的节点为空
+	Host     string   `yaml:"host,omitempty"`  // 节点域名
+	Port     int      `yaml:"port,omitempty"`  // SSH 端口，为空时使用 22
 	Username string   `yaml:"username"`
-	Password string   `yaml:"password"`
+	Password string   `yaml:"password"` // 加密后的密码，v2 格式或旧版十六进制 CBC 格式
 	Tags     []string `yaml:"tag"`
+
+	KeyPath    string `yaml:"key_path,omitempty"`    // 私钥文件路径
+	PrivateKey string `yaml:"private_key,omitempty"` // 加密后的内嵌私钥
+	Passphrase string `yaml:"passphrase,omitempty"`  // 加密后的私钥口令
+
+	HostKeyPolicy string `yaml:"host_key_policy,omitempty"` // 节点的主机密钥校验策略，为空时使用全局配置
+	ForwardAgent  bool   `yaml:"forward_agent,omitempty"`   // 连接时是否默认开启 agent 转发
+
+	KeepaliveInterval int `yaml:"keepalive_interval,omitempty"` // 节点的心跳间隔（秒），为 0 时使用全局配置，为负数时不发送心跳
+
+	Jump  []string `yaml:"jump,omitempty"`  // 按顺序经过的跳板节点，使用节点标识或别名引用
+	Proxy *Proxy   `yaml:"proxy,omitempty"` // 节点的代理配置，为空时使用全局代理
+
+	LocalForwards   []string `yaml:"local_forward,omitempty"`   // 连接时自动建立的本地转发，格式 [bind:]port:host:hostport
+	RemoteForwards  []string `yaml:"remote_forward,omitempty"`  // 连接时自动建立的远程转发，格式 [bind:]port:host:hostport
+	DynamicForwards []string `yaml:"dynamic_forward,omitempty"` // 连接时自动建立的 SOCKS5 转发，格式 [bind:]port
 }
 
+// Proxy 代理配置
+type Proxy struct {
+	URL      string `yaml:"url"`                // 代理地址，支持 socks5:// 和 http://，不包含密码；为 direct 时不使用代理
+	Password string `yaml:"password,omitempty"` // 加密后的代理密码
+}
+
+// ProxyDirect 节点不使用全局代理
+const ProxyDirect = "direct"
+
 // NodesFile 存储节点的文件结构
 type NodesFile struct {
+	Version  int                 `yaml:"version"`            // 文件格式版本，用于迁移
+	Salt     string              `yaml:"salt"`               // 保险库盐值（base64），用于派生加密密钥
+	Verifier string              `yaml:"verifier,omitempty"` // 密钥校验值，用于提前拒绝错误的密钥
+	Proxy    *Proxy              `yaml:"proxy,omitempty"`    // 全局代理配置
 	Nodes    []Node              `yaml:"nodes"`
-	TagIndex map[string][]string `yaml:"tag_index"`
+	TagIndex map[string][]string `yaml:"tag_index,omitempty"` // 标签索引，加载时根据节点重新生成，只在开启 write_tag_index 时写入
 }
 
+// DefaultPort SSH 默认端口
+const DefaultPort = 22
+
 var (
 	Version     = "v2024.11.27"
-	configPath  = filepath.Join(os.Getenv("HOME"), ".sshe", "sshe.conf")
-	nodesPath   = filepath.Join(os.Getenv("HOME"), ".sshe", "node.yaml")
+	configDir   = filepath.Join(os.Getenv("HOME"), ".sshe")
+	configPath  = filepath.Join(configDir, "sshe.conf")
+	nodesPath   = filepath.Join(configDir, "node.yaml")
 	defaultConf = Config{
 		SecretKey: "sshe2024",
 	}
 	GlobalConfig = Config{}
 	GlobalNode   = NodesFile{}
+
+	// 读取时的文档节点，写回时保留用户的注释和键的顺序
+	configDoc *yaml.Node
+	nodesDoc  *yaml.Node
+)
+
+var (
+	// KnownHostsPath sshe 自己维护的 known_hosts 文件
+	KnownHostsPath = filepath.Join(os.Getenv("HOME"), ".sshe", "known_hosts")
+	// SystemKnownHostsPath OpenSSH 的 known_hosts 文件
+	SystemKnownHostsPath = filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+	// RecordingsPath 会话录制文件的保存目录
+	RecordingsPath = filepath.Join(os.Getenv("HOME"), ".sshe", "recordings")
 )
 
-// loadYAMLFile 用于读取 YAML 文件并解码
-func loadYAMLFile(filePath string, v interface{}) error {
+// ConfigDir 返回配置目录
+func ConfigDir() string {
+	return configDir
+}
+
+// Address 节点地址，优先使用域名
+func (n Node) Address() string {
+	if n.Host != "" {
+		return n.Host
+	}
+	return n.IP
+}
+
+// SSHPort 节点的 SSH 端口
+func (n Node) SSHPort() int {
+	if n.Port == 0 {
+		return DefaultPort
+	}
+	return n.Port
+}
+
+// Endpoint 用于建立连接的 host:port
+func (n Node) Endpoint() string {
+	return net.JoinHostPort(n.Address(), strconv.Itoa(n.SSHPort()))
+}
+
+// HostPort 用于展示的地址，默认端口时省略端口
+func (n Node) HostPort() string {
+	if n.SSHPort() == DefaultPort {
+		return n.Address()
+	}
+	return n.Endpoint()
+}
+
+// ID 节点唯一标识，格式为 address@username 或 address:port@username
+func (n Node) ID() string {
+	return n.HostPort() + "@" + n.Username
+}
+
+// SecretField 节点中的加密字段及其名称
+type SecretField struct {
+	Name  string
+	Value *string
+}
+
+// SecretFields 节点中所有的加密字段，新增加密字段时只需在这里添加
+func (n *Node) SecretFields() []SecretField {
+	fields := []SecretField{
+		{"password", &n.Password},
+		{"private_key", &n.PrivateKey},
+		{"passphrase", &n.Passphrase},
+	}
+	if n.Proxy != nil {
+		fields = append(fields, SecretField{"proxy password", &n.Proxy.Password})
+	}
+	return fields
+}
+
+// Secrets 节点中所有加密字段的指针，用于统一重新加密
+func (n *Node) Secrets() []*string {
+	var secrets []*string
+	for _, field := range n.SecretFields() {
+		secrets = append(secrets, field.Value)
+	}
+	return secrets
+}
+
+// Secrets 保险库中所有加密字段的指针
+func (f *NodesFile) Secrets() []*string {
+	var secrets []*string
+	if f.Proxy != nil {
+		secrets = append(secrets, &f.Proxy.Password)
+	}
+	for i := range f.Nodes {
+		secrets = append(secrets, f.Nodes[i].Secrets()...)
+	}
+	return secrets
+}
+
+// Clone 复制节点数据，修改副本中的节点和加密字段不会影响原数据
+func (f NodesFile) Clone() NodesFile {
+	clone := f
+	if f.Proxy != nil {
+		proxy := *f.Proxy
+		clone.Proxy = &proxy
+	}
+	clone.Nodes = make([]Node, len(f.Nodes))
+	for i, node := range f.Nodes {
+		if node.Proxy != nil {
+			proxy := *node.Proxy
+			node.Proxy = &proxy
+		}
+		clone.Nodes[i] = node
+	}
+	return clone
+}
+
+// loadYAMLDocument 读取 YAML 文件的文档节点，写回时用于保留注释和顺序
+func loadYAMLDocument(filePath string) (*yaml.Node, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %v", filePath, err)
+		return nil, fmt.Errorf("failed to open file %s: %v", filePath, err)
 	}
 	defer func(file *os.File) {
 		err := file.Close()
@@ -50,172 +211,553 @@ func loadYAMLFile(filePath string, v interface{}) error {
 		}
 	}(file)
 
+	var doc yaml.Node
 	decoder := yaml.NewDecoder(file)
-	if err := decoder.Decode(v); err != nil {
-		return fmt.Errorf("failed to decode YAML file %s: %v", filePath, err)
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode YAML file %s: %v", filePath, err)
 	}
-	return nil
+	return &doc, nil
+}
+
+// loadYAMLFile 用于读取 YAML 文件并解码，同时返回文件的文档节点
+func loadYAMLFile(filePath string, v interface{}) (*yaml.Node, error) {
+	doc, err := loadYAMLDocument(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Decode(v); err != nil {
+		return nil, fmt.Errorf("failed to decode YAML file %s: %v", filePath, err)
+	}
+	return doc, nil
 }
 
 // writeYAMLFile 用于将数据编码并写入 YAML 文件
+// 先写入同目录下的临时文件并落盘，再重命名替换目标文件，写入中途失败不会破坏原文件
 func writeYAMLFile(filePath string, v interface{}) error {
-	file, err := os.Create(filePath)
+	tmpPath, err := writeYAMLTempFile(filePath, v)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %v", filePath, err)
+		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			fmt.Printf("Failed to close file: %v\n", err)
-		}
-	}(file)
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file %s: %v", filePath, err)
+	}
+	syncDir(filepath.Dir(filePath))
+	return nil
+}
 
-	encoder := yaml.NewEncoder(file)
-	defer func(encoder *yaml.Encoder) {
-		err := encoder.Close()
-		if err != nil {
-			fmt.Printf("Failed to close encoder: %v\n", err)
-		}
-	}(encoder)
+// syncDir 将目录项落盘，确保重命名在崩溃后仍然有效
+func syncDir(dir string) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = file.Sync()
+	_ = file.Close()
+}
 
-	if err := encoder.Encode(v); err != nil {
-		return fmt.Errorf("failed to write YAML file %s: %v", filePath, err)
+// writeYAMLTempFile 将数据写入目标文件同目录下的临时文件并落盘，返回临时文件路径
+func writeYAMLTempFile(filePath string, v interface{}) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for %s: %v", filePath, err)
 	}
-	return nil
+	tmpPath := file.Name()
+
+	encoder := yaml.NewEncoder(file)
+	err = encoder.Encode(v)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write temp file for %s: %v", filePath, err)
+	}
+	return tmpPath, nil
 }
 
-// LoadConfig 加载配置文件
+// LoadConfig 加载配置文件，只有文件不存在或补充了缺失的字段时才写入
 func LoadConfig() error {
 	// 创建 ~/.sshe/ 目录，若已存在则不影响
-	home := filepath.Join(os.Getenv("HOME"), ".sshe")
-	if err := os.MkdirAll(home, 0700); err != nil {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
 		return fmt.Errorf("failed to create config directory: %v", err)
 	}
 
-	// 检查并初始化 sshe.conf 配置文件
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		// 配置文件不存在，创建并写入默认配置
-		GlobalConfig = defaultConf
-		if err := writeYAMLFile(configPath, GlobalConfig); err != nil {
-			return err
-		}
-	} else {
-		// 配置文件存在，读取并补充缺失的字段
-		if err := loadYAMLFile(configPath, &GlobalConfig); err != nil {
-			return err
+	if err := loadWithFill(readConfigFile, func() error {
+		doc, err := yamlDocument(GlobalConfig, configDoc)
+		if err == nil {
+			err = writeYAMLFile(configPath, doc)
 		}
+		configDoc = doc
+		return err
+	}); err != nil {
+		return err
+	}
 
-		if GlobalConfig.SecretKey == "" {
-			GlobalConfig.SecretKey = defaultConf.SecretKey
+	var plan *MigrationPlan
+	return loadWithFill(func() (bool, error) {
+		var changed bool
+		var err error
+		changed, plan, err = readNodesFile()
+		return changed, err
+	}, func() error {
+		if plan != nil {
+			// 迁移前先备份原文件
+			backupPath, err := writeMigratedNodes(GlobalNode, nodesDoc, plan)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "Migrated %s from version %d to %d, backup saved to %s\n", nodesPath, plan.From, plan.To, backupPath)
+			return nil
 		}
-
-		// 重新写回补充后的配置
-		if err := writeYAMLFile(configPath, GlobalConfig); err != nil {
-			return err
+		doc, err := nodesDocument(GlobalNode, nodesDoc)
+		if err == nil {
+			err = writeYAMLFile(nodesPath, doc)
 		}
+		nodesDoc = doc
+		return err
+	})
+}
+
+// loadWithFill 读取文件，需要补充内容时在锁内重新读取后再写回，避免覆盖其他进程刚写入的内容
+func loadWithFill(read func() (bool, error), write func() error) error {
+	changed, err := read()
+	if err != nil || !changed {
+		return err
+	}
+
+	unlock, err := lockConfigDir()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	changed, err = read()
+	if err != nil || !changed {
+		return err
+	}
+	return write()
+}
+
+// readConfigFile 读取 sshe.conf，返回是否需要写回
+func readConfigFile() (bool, error) {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		// 配置文件不存在，使用默认配置
+		GlobalConfig, configDoc = defaultConf, nil
+		return true, nil
+	}
+
+	// 配置文件存在，读取并补充缺失的字段
+	var conf Config
+	doc, err := loadYAMLFile(configPath, &conf)
+	if err != nil {
+		return false, err
+	}
+	GlobalConfig, configDoc = conf, doc
+
+	if GlobalConfig.SecretKey == "" && !GlobalConfig.MasterPassword {
+		GlobalConfig.SecretKey = defaultConf.SecretKey
+		return true, nil
 	}
+	return false, nil
+}
 
-	// 检查并初始化 node.yaml
+// readNodesFile 读取 node.yaml，返回是否需要写回，以及需要写回的迁移
+// 关闭 AutoMigrate 时不迁移也不写回文件
+func readNodesFile() (bool, *MigrationPlan, error) {
 	if _, err := os.Stat(nodesPath); os.IsNotExist(err) {
-		// 节点文件不存在，创建并初始化
-		initialNodes := NodesFile{
-			Nodes:    []Node{},
-			TagIndex: map[string][]string{},
+		// 节点文件不存在，初始化新的保险库
+		salt, err := utils.NewSalt()
+		if err != nil {
+			return false, nil, err
 		}
-		if err := writeYAMLFile(nodesPath, initialNodes); err != nil {
-			return err
+		GlobalNode = NodesFile{
+			Version: CurrentVersion,
+			Salt:    base64.StdEncoding.EncodeToString(salt),
 		}
-	} else {
-		// 节点文件存在，读取并补充缺失的部分
-		if err := loadYAMLFile(nodesPath, &GlobalNode); err != nil {
-			return err
+		GlobalNode.normalize()
+		nodesDoc = nil
+		return true, nil, nil
+	}
+
+	// 节点文件存在，按需迁移后读取并补充缺失的部分
+	doc, err := loadYAMLDocument(nodesPath)
+	if err != nil {
+		return false, nil, err
+	}
+	// 关闭自动迁移时按原格式读取，由 migrate 命令负责迁移和写回
+	var plan *MigrationPlan
+	if AutoMigrate {
+		if plan, err = migrateDocument(doc); err != nil {
+			return false, nil, err
 		}
+	}
+	var nodes NodesFile
+	if err := doc.Decode(&nodes); err != nil {
+		return false, nil, fmt.Errorf("failed to decode YAML file %s: %v", nodesPath, err)
+	}
+	nodes.normalize()
+	filled, err := nodes.fillSalt()
+	if err != nil {
+		return false, nil, err
+	}
+	GlobalNode, nodesDoc = nodes, doc
 
-		// 补充缺失的字段
-		if GlobalNode.Nodes == nil {
-			GlobalNode.Nodes = []Node{}
+	// 不迁移时补充的盐值只在内存中使用，不写回文件
+	return plan != nil || (filled && AutoMigrate), plan, nil
+}
+
+// fillSalt 盐值为空时生成新的盐值，返回是否做了补充
+func (f *NodesFile) fillSalt() (bool, error) {
+	if f.Salt != "" {
+		return false, nil
+	}
+	salt, err := utils.NewSalt()
+	if err != nil {
+		return false, err
+	}
+	f.Salt = base64.StdEncoding.EncodeToString(salt)
+	return true, nil
+}
+
+// VaultSalt 获取保险库盐值
+func VaultSalt() ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(GlobalNode.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault salt: %v", err)
+	}
+	return salt, nil
+}
+
+// SaveVault 使用新的节点数据和配置替换当前保险库
+// 两个文件都先写入临时文件，全部成功后再替换，避免写入失败导致保险库损坏
+// 替换前的一组文件保存为 node.yaml.vault.bak 和 sshe.conf.vault.bak，替换成功后删除，只有两次替换之间崩溃时才会留下用于恢复
+func SaveVault(nodes NodesFile, conf Config) error {
+	unlock, err := lockConfigDir()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// 新数据基于当前进程读取的节点，期间其他进程修改过节点文件时放弃写入，避免覆盖其修改
+	var current NodesFile
+	currentDoc, err := loadYAMLFile(nodesPath, &current)
+	if err != nil {
+		return err
+	}
+	current.normalize()
+	if !sameNodesFile(current, GlobalNode) {
+		return errVaultModified
+	}
+
+	newNodesDoc, err := nodesDocument(nodes, currentDoc)
+	if err != nil {
+		return err
+	}
+	newConfigDoc, err := yamlDocument(conf, configDoc)
+	if err != nil {
+		return err
+	}
+	nodesTmp, err := writeYAMLTempFile(nodesPath, newNodesDoc)
+	if err != nil {
+		return fmt.Errorf("failed to write nodes file: %v", err)
+	}
+	configTmp, err := writeYAMLTempFile(configPath, newConfigDoc)
+	if err != nil {
+		_ = os.Remove(nodesTmp)
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+
+	// 两个文件无法同时替换，先保留当前的一组文件，两次重命名之间崩溃时可以用它们恢复
+	if err := backupVaultFiles(); err != nil {
+		_ = os.Remove(nodesTmp)
+		_ = os.Remove(configTmp)
+		return err
+	}
+
+	if err := os.Rename(nodesTmp, nodesPath); err != nil {
+		_ = os.Remove(nodesTmp)
+		_ = os.Remove(configTmp)
+		removeVaultBackups()
+		return fmt.Errorf("failed to replace nodes file: %v", err)
+	}
+	if err := os.Rename(configTmp, configPath); err != nil {
+		_ = os.Remove(configTmp)
+		// 恢复原来的节点文件，使其与未替换的配置文件匹配，恢复失败时保留备份
+		if restoreErr := restoreVaultBackup(nodesPath); restoreErr != nil {
+			return fmt.Errorf("failed to replace config file: %v, and failed to restore %s: %v, restore it from %s", err, nodesPath, restoreErr, nodesPath+vaultBackupSuffix)
 		}
-		if GlobalNode.TagIndex == nil {
-			GlobalNode.TagIndex = map[string][]string{}
+		removeVaultBackups()
+		return fmt.Errorf("failed to replace config file: %v", err)
+	}
+	syncDir(configDir)
+	// 备份中是旧的密钥和用它加密的数据，替换成功后立即删除，只有中途崩溃时才会留下
+	removeVaultBackups()
+	GlobalNode, nodesDoc = nodes, newNodesDoc
+	GlobalConfig, configDoc = conf, newConfigDoc
+
+	return nil
+}
+
+// 重新加密前保存的节点文件和配置文件的后缀
+const vaultBackupSuffix = ".vault.bak"
+
+// backupVaultFiles 使用硬链接保存当前的节点文件和配置文件，覆盖上一次的备份，需持有锁
+func backupVaultFiles() error {
+	for _, path := range []string{nodesPath, configPath} {
+		backupPath := path + vaultBackupSuffix
+		if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old backup %s: %v", backupPath, err)
+		}
+		if err := os.Link(path, backupPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to back up %s: %v", path, err)
 		}
+	}
+	syncDir(configDir)
+	return nil
+}
 
-		// 重新写回更新后的节点数据
-		if err := writeYAMLFile(nodesPath, GlobalNode); err != nil {
-			return err
+// removeVaultBackups 删除重新加密前保存的节点文件和配置文件
+func removeVaultBackups() {
+	for _, path := range []string{nodesPath, configPath} {
+		_ = os.Remove(path + vaultBackupSuffix)
+	}
+	syncDir(configDir)
+}
+
+// SecretBackups 返回配置目录中的节点文件和配置文件备份，其中可能包含旧密钥或用旧密钥加密的数据
+func SecretBackups() ([]string, error) {
+	var backups []string
+	for _, path := range []string{nodesPath, configPath} {
+		matches, err := filepath.Glob(path + ".*.bak")
+		if err != nil {
+			return nil, err
 		}
+		backups = append(backups, matches...)
 	}
+	return backups, nil
+}
 
+// restoreVaultBackup 用备份替换文件，备份本身保留
+func restoreVaultBackup(path string) error {
+	tmpPath := path + ".restore.tmp"
+	_ = os.Remove(tmpPath)
+	if err := os.Link(path+vaultBackupSuffix, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(path))
 	return nil
 }
 
-// AddNode 将节点信息添加到配置文件
-func AddNode(ip, username, encryptedPassword string, tags []string) error {
-	node := Node{
-		IP:       ip,
-		Username: username,
-		Password: encryptedPassword,
-		Tags:     tags,
+// 节点文件被其他进程重新加密或修改
+var errVaultModified = errors.New("the vault was modified by another sshe process, please retry")
+
+// normalize 补充缺失的字段，并根据节点重新生成标签索引
+func (f *NodesFile) normalize() {
+	if f.Nodes == nil {
+		f.Nodes = []Node{}
+	}
+	f.TagIndex = BuildTagIndex(f.Nodes)
+}
+
+// BuildTagIndex 根据节点的标签生成索引，每个标签下的节点按节点顺序排列且不重复
+func BuildTagIndex(nodes []Node) map[string][]string {
+	index := map[string][]string{}
+	for _, node := range nodes {
+		for _, tag := range node.Tags {
+			if !slices.Contains(index[tag], node.ID()) {
+				index[tag] = append(index[tag], node.ID())
+			}
+		}
 	}
+	return index
+}
 
-	// 添加到 GlobalNode
-	GlobalNode.Nodes = append(GlobalNode.Nodes, node)
-	for _, tag := range tags {
-		GlobalNode.TagIndex[tag] = append(GlobalNode.TagIndex[tag], fmt.Sprintf("%s@%s", node.IP, node.Username))
+// StoredTagIndex 读取节点文件中保存的标签索引，文件中没有索引时返回 nil
+func StoredTagIndex() (map[string][]string, error) {
+	var stored struct {
+		TagIndex map[string][]string `yaml:"tag_index"`
 	}
+	if _, err := loadYAMLFile(nodesPath, &stored); err != nil {
+		return nil, err
+	}
+	return stored.TagIndex, nil
+}
 
-	// 重新写回节点文件
-	if err := writeYAMLFile(nodesPath, GlobalNode); err != nil {
-		return fmt.Errorf("failed to update nodes file: %v", err)
+// nodesDocument 将节点数据编码为 YAML 文档，未开启 write_tag_index 时不写入标签索引
+func nodesDocument(nodes NodesFile, doc *yaml.Node) (*yaml.Node, error) {
+	if !GlobalConfig.WriteTagIndex {
+		nodes.TagIndex = nil
 	}
+	return yamlDocument(nodes, doc)
+}
+
+// sameNodesFile 两份节点数据编码后是否一致
+func sameNodesFile(a, b NodesFile) bool {
+	dataA, errA := yaml.Marshal(a)
+	dataB, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// UpdateNodes 在锁内重新读取节点文件并应用修改，再原子地写回，标签索引会重新生成
+// 基于磁盘上的最新数据修改，其他终端中同时执行的修改不会被覆盖
+func UpdateNodes(update func(nodes *NodesFile) error) error {
+	unlock, err := lockConfigDir()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
+	var nodes NodesFile
+	doc, err := loadYAMLFile(nodesPath, &nodes)
+	if err != nil {
+		return err
+	}
+	nodes.normalize()
+	// 盐值变化说明保险库已被重新加密，当前进程加密的数据无法再使用；版本变化说明已被其他版本的 sshe 迁移
+	if nodes.Salt != GlobalNode.Salt || nodes.Version != GlobalNode.Version {
+		return errVaultModified
+	}
+
+	if err := update(&nodes); err != nil {
+		return err
+	}
+	nodes.normalize()
+	if doc, err = nodesDocument(nodes, doc); err != nil {
+		return err
+	}
+	if err := writeYAMLFile(nodesPath, doc); err != nil {
+		return fmt.Errorf("failed to update nodes file: %v", err)
+	}
+	GlobalNode, nodesDoc = nodes, doc
 	return nil
 }
 
-// GetNode 根据 IP 和用户名获取节点信息
-func GetNode(ip, username string) ([]Node, error) {
-	var matchedNodes []Node
+// SetProxy 设置全局代理，proxy 为 nil 时清除
+func SetProxy(proxy *Proxy) error {
+	return UpdateNodes(func(nodes *NodesFile) error {
+		nodes.Proxy = proxy
+		return nil
+	})
+}
 
-	for _, node := range GlobalNode.Nodes {
-		if (username == "" && node.IP == ip) || (username != "" && node.IP == ip && node.Username == username) {
-			matchedNodes = append(matchedNodes, node)
+// AddNode 将节点信息添加到配置文件，节点密码需已加密
+func AddNode(node Node) error {
+	return UpdateNodes(func(nodes *NodesFile) error {
+		// 其他进程可能已经添加了相同的节点
+		for _, existing := range nodes.Nodes {
+			if existing.ID() == node.ID() {
+				return fmt.Errorf("node %s already exists", node.ID())
+			}
+			if node.Alias != "" && existing.Alias == node.Alias {
+				return fmt.Errorf("the alias %s is already used by %s", node.Alias, existing.ID())
+			}
 		}
-	}
 
-	return matchedNodes, nil
+		nodes.Nodes = append(nodes.Nodes, node)
+		return nil
+	})
 }
 
-// DeleteNode 根据 IP 和用户名删除节点
-func DeleteNode(ip, username string) error {
-	var nodeFound bool
-	for i, node := range GlobalNode.Nodes {
-		if node.IP == ip && node.Username == username {
-			// 删除该节点
-			GlobalNode.Nodes = append(GlobalNode.Nodes[:i], GlobalNode.Nodes[i+1:]...)
-
-			// 删除 tag_index 中的记录
-			for _, tag := range node.Tags {
-				taggedNodes := GlobalNode.TagIndex[tag]
-				for j, taggedNode := range taggedNodes {
-					if taggedNode == node.IP+"@"+node.Username {
-						GlobalNode.TagIndex[tag] = append(taggedNodes[:j], taggedNodes[j+1:]...)
-						break
+// UpdateNode 修改标识为 id 的节点，标识变化时同时更新其他节点跳板中的引用
+func UpdateNode(id string, update func(node *Node) error) error {
+	return UpdateNodes(func(nodes *NodesFile) error {
+		index := -1
+		for i := range nodes.Nodes {
+			if nodes.Nodes[i].ID() == id {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("node %s was not found", id)
+		}
+
+		node := nodes.Nodes[index]
+		if err := update(&node); err != nil {
+			return err
+		}
+		for i, existing := range nodes.Nodes {
+			if i == index {
+				continue
+			}
+			if existing.ID() == node.ID() {
+				return fmt.Errorf("node %s already exists", node.ID())
+			}
+			if node.Alias != "" && existing.Alias == node.Alias {
+				return fmt.Errorf("the alias %s is already used by %s", node.Alias, existing.ID())
+			}
+		}
+		nodes.Nodes[index] = node
+
+		if node.ID() != id {
+			for i := range nodes.Nodes {
+				for j, jump := range nodes.Nodes[i].Jump {
+					if jump == id {
+						nodes.Nodes[i].Jump[j] = node.ID()
 					}
 				}
 			}
-			// 标记已找到
-			nodeFound = true
-			break
 		}
-	}
-
-	if !nodeFound {
 		return nil
+	})
+}
+
+// GetNode 根据地址、端口和用户名获取节点信息，端口为 0 或用户名为空时不作限制
+func GetNode(address string, port int, username string) ([]Node, error) {
+	var matchedNodes []Node
+
+	for _, node := range GlobalNode.Nodes {
+		if node.Address() != address {
+			continue
+		}
+		if port != 0 && node.SSHPort() != port {
+			continue
+		}
+		if username != "" && node.Username != username {
+			continue
+		}
+		matchedNodes = append(matchedNodes, node)
 	}
 
-	// 重新写回节点文件
-	if err := writeYAMLFile(nodesPath, GlobalNode); err != nil {
-		return fmt.Errorf("failed to update nodes file: %v", err)
+	return matchedNodes, nil
+}
+
+// FindNode 根据别名或节点标识（address@username、address:port@username）查找节点
+func FindNode(ref string) (Node, bool) {
+	for _, node := range GlobalNode.Nodes {
+		if node.Alias != "" && node.Alias == ref {
+			return node, true
+		}
 	}
+	for _, node := range GlobalNode.Nodes {
+		if node.ID() == ref {
+			return node, true
+		}
+	}
+	return Node{}, false
+}
 
-	return nil
+// DeleteNode 根据地址、端口和用户名删除节点，节点不存在时返回错误且不写入文件
+func DeleteNode(address string, port int, username string) error {
+	return UpdateNodes(func(nodes *NodesFile) error {
+		for i, node := range nodes.Nodes {
+			if node.Address() == address && node.SSHPort() == port && node.Username == username {
+				// 删除该节点，标签索引会重新生成
+				nodes.Nodes = append(nodes.Nodes[:i], nodes.Nodes[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("node %s:%d@%s was not found", address, port, username)
+	})
 }
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestDeleteMissingNodeLeavesFileUntouched(t *testing.T) {
+	original := useLegacyFixture(t)
+
+	AutoMigrate = false
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if err := DeleteNode("example.org", DefaultPort, "root"); err == nil {
+		t.Fatal("expected an error for a missing node")
+	}
+
+	data, err := os.ReadFile(nodesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Fatalf("deleting a missing node modified the nodes file:\n%s", data)
+	}
+}
+
+func TestBackupVaultFilesKeepsCurrentPair(t *testing.T) {
+	useLegacyFixture(t)
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	want := make(map[string][]byte)
+	for _, path := range []string{nodesPath, configPath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[path] = data
+	}
+
+	if err := backupVaultFiles(); err != nil {
+		t.Fatalf("backupVaultFiles: %v", err)
+	}
+	for path, data := range want {
+		backup, err := os.ReadFile(path + vaultBackupSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(backup, data) {
+			t.Errorf("%s does not hold the current file:\n%s", path+vaultBackupSuffix, backup)
+		}
+	}
+}
+
+func TestSaveVaultRemovesBackupsAfterSuccess(t *testing.T) {
+	useLegacyFixture(t)
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	nodes, conf := GlobalNode.Clone(), GlobalConfig
+	nodes.Salt = "bmV3LXNhbHQ="
+	conf.SecretKey = "new-secret"
+	if err := SaveVault(nodes, conf); err != nil {
+		t.Fatalf("SaveVault: %v", err)
+	}
+
+	// 备份中是旧密钥和旧密文，成功后不能留在磁盘上
+	for _, path := range []string{nodesPath, configPath} {
+		if _, err := os.Stat(path + vaultBackupSuffix); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind", path+vaultBackupSuffix)
+		}
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("new-secret")) {
+		t.Fatalf("config file was not replaced:\n%s", data)
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockConfigDir 对 ~/.sshe 目录加排他的建议锁（flock），返回解锁函数
+// 锁只在 sshe 进程之间生效，用于串行化对配置文件的读取-修改-写入
+func lockConfigDir() (func(), error) {
+	dir, err := os.Open(configDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config directory: %v", err)
+	}
+	if err := syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		_ = dir.Close()
+		return nil, fmt.Errorf("failed to lock config directory: %v", err)
+	}
+	return func() {
+		_ = syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+		_ = dir.Close()
+	}, nil
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Migration 节点文件的格式迁移，将文件从 Version-1 升级到 Version
+type Migration struct {
+	Version     int
+	Description string
+	// Apply 在文档的根映射上修改数据，返回每一处修改的说明
+	Apply func(root *yaml.Node) ([]string, error)
+}
+
+// 按版本顺序排列的迁移，新增格式变化时在末尾追加，不能修改已发布的迁移
+var migrations = []Migration{
+	{Version: 1, Description: "move host names stored in ip to host", Apply: migrateHostNames},
+}
+
+// CurrentVersion 当前支持的节点文件版本
+var CurrentVersion = migrations[len(migrations)-1].Version
+
+// MigrationPlan 一次迁移的结果
+type MigrationPlan struct {
+	From    int
+	To      int
+	Changes []string // 每一处修改的说明，按迁移顺序排列
+}
+
+// AutoMigrate 加载配置时是否自动迁移并写回节点文件
+var AutoMigrate = true
+
+// migrateDocument 在节点文件的文档上依次执行需要的迁移，文档已是最新版本时返回 nil
+func migrateDocument(doc *yaml.Node) (*MigrationPlan, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid nodes file: root is not a mapping")
+	}
+	root := doc.Content[0]
+
+	version := 0
+	if value := mappingValue(root, "version"); value != nil {
+		v, err := strconv.Atoi(value.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nodes file version %q", value.Value)
+		}
+		version = v
+	}
+	if version > CurrentVersion {
+		return nil, fmt.Errorf("nodes file version %d is newer than supported version %d, please upgrade sshe", version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return nil, nil
+	}
+
+	plan := &MigrationPlan{From: version, To: CurrentVersion}
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		changes, err := m.Apply(root)
+		if err != nil {
+			return nil, fmt.Errorf("migration to version %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+		plan.Changes = append(plan.Changes, fmt.Sprintf("v%d: %s", m.Version, m.Description))
+		for _, change := range changes {
+			plan.Changes = append(plan.Changes, "  "+change)
+		}
+		setVersion(root, m.Version)
+	}
+	return plan, nil
+}
+
+// PlanMigration 读取节点文件并返回需要执行的迁移，不修改文件，无需迁移时返回 nil
+func PlanMigration() (*MigrationPlan, error) {
+	doc, err := loadYAMLDocument(nodesPath)
+	if err != nil {
+		return nil, err
+	}
+	return migrateDocument(doc)
+}
+
+// Migrate 迁移节点文件，写回前备份原文件，无需迁移时返回 nil
+func Migrate() (*MigrationPlan, string, error) {
+	unlock, err := lockConfigDir()
+	if err != nil {
+		return nil, "", err
+	}
+	defer unlock()
+
+	doc, err := loadYAMLDocument(nodesPath)
+	if err != nil {
+		return nil, "", err
+	}
+	plan, err := migrateDocument(doc)
+	if err != nil || plan == nil {
+		return plan, "", err
+	}
+
+	var nodes NodesFile
+	if err := doc.Decode(&nodes); err != nil {
+		return nil, "", fmt.Errorf("failed to decode migrated nodes file: %v", err)
+	}
+	nodes.normalize()
+	if _, err := nodes.fillSalt(); err != nil {
+		return nil, "", err
+	}
+	backupPath, err := writeMigratedNodes(nodes, doc, plan)
+	if err != nil {
+		return nil, "", err
+	}
+	return plan, backupPath, nil
+}
+
+// writeMigratedNodes 备份迁移前的节点文件后写回迁移后的数据，需持有锁
+func writeMigratedNodes(nodes NodesFile, doc *yaml.Node, plan *MigrationPlan) (string, error) {
+	backupPath, err := BackupNodesFile(fmt.Sprintf("v%d", plan.From))
+	if err != nil {
+		return "", err
+	}
+	doc, err = nodesDocument(nodes, doc)
+	if err != nil {
+		return "", err
+	}
+	if err := writeYAMLFile(nodesPath, doc); err != nil {
+		return "", fmt.Errorf("failed to write migrated nodes file: %v", err)
+	}
+	GlobalNode, nodesDoc = nodes, doc
+	return backupPath, nil
+}
+
+// BackupNodesFile 将节点文件复制为 node.yaml.<label>.<时间>.bak，返回备份文件路径
+func BackupNodesFile(label string) (string, error) {
+	data, err := os.ReadFile(nodesPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read nodes file: %v", err)
+	}
+	backupPath := fmt.Sprintf("%s.%s.%s.bak", nodesPath, label, time.Now().Format("20060102150405"))
+	if err := os.WriteFile(backupPath, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to back up nodes file: %v", err)
+	}
+	return backupPath, nil
+}
+
+// setVersion 设置文档中的版本号，新增时放在最前面
+func setVersion(root *yaml.Node, version int) {
+	if value := mappingValue(root, "version"); value != nil {
+		value.Tag, value.Value, value.Style = "!!int", strconv.Itoa(version), 0
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(version)}
+	// 文件开头的注释仍然放在最前面
+	if len(root.Content) > 0 {
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, value}, root.Content...)
+}
+
+// mappingValue 获取映射中指定键的值，不存在时返回 nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// migrateHostNames v1：手动编辑时写在 ip 中的域名移到 host 字段，节点标识不变
+func migrateHostNames(root *yaml.Node) ([]string, error) {
+	nodes := mappingValue(root, "nodes")
+	if nodes == nil || nodes.Kind != yaml.SequenceNode {
+		return nil, nil
+	}
+
+	var changes []string
+	for _, node := range nodes.Content {
+		if node.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value != "ip" || value.Value == "" || net.ParseIP(value.Value) != nil {
+				continue
+			}
+			if mappingValue(node, "host") != nil {
+				return nil, fmt.Errorf("node %s has both ip and host", value.Value)
+			}
+			key.Value = "host"
+			changes = append(changes, fmt.Sprintf("nodes: move %s from ip to host", value.Value))
+		}
+	}
+	return changes, nil
+}
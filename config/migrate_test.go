@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 旧版本写入的节点文件：没有版本号和盐值，ip 中写了域名
+const legacyNodes = `nodes:
+    - ip: example.com
+      username: root
+      password: x
+      tag:
+        - web
+tag_index:
+    web:
+        - example.com@root
+`
+
+// 将配置目录指向临时目录并写入旧版节点文件
+func useLegacyFixture(t *testing.T) []byte {
+	t.Helper()
+	dir := t.TempDir()
+	oldDir, oldConfig, oldNodes := configDir, configPath, nodesPath
+	configDir, configPath, nodesPath = dir, filepath.Join(dir, "sshe.conf"), filepath.Join(dir, "node.yaml")
+	oldAuto := AutoMigrate
+	t.Cleanup(func() {
+		configDir, configPath, nodesPath = oldDir, oldConfig, oldNodes
+		AutoMigrate = oldAuto
+	})
+
+	data := []byte(legacyNodes)
+	if err := os.WriteFile(nodesPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDryRunLeavesLegacyFileUntouched(t *testing.T) {
+	original := useLegacyFixture(t)
+
+	// migrate 命令加载配置时不迁移
+	AutoMigrate = false
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	plan, err := PlanMigration()
+	if err != nil {
+		t.Fatalf("PlanMigration: %v", err)
+	}
+	if plan == nil || plan.From != 0 || plan.To != CurrentVersion {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+
+	data, err := os.ReadFile(nodesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Fatalf("dry run modified the nodes file:\n%s", data)
+	}
+	backups, _ := filepath.Glob(nodesPath + ".*.bak")
+	if len(backups) != 0 {
+		t.Fatalf("dry run created backups: %v", backups)
+	}
+}
+
+func TestMigrateBacksUpLegacyFile(t *testing.T) {
+	original := useLegacyFixture(t)
+
+	AutoMigrate = false
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	plan, backupPath, err := Migrate()
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if plan == nil {
+		t.Fatal("expected a migration")
+	}
+
+	backup, err := os.ReadFile(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(backup, original) {
+		t.Fatalf("backup differs from the original file:\n%s", backup)
+	}
+	data, err := os.ReadFile(nodesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"version: 1", "host: example.com", "salt: "} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("migrated file is missing %q:\n%s", want, data)
+		}
+	}
+
+	// 再次迁移时无需修改
+	if plan, _, err := Migrate(); err != nil || plan != nil {
+		t.Fatalf("second Migrate: plan %+v, err %v", plan, err)
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strconv"
+)
+
+// yamlDocument 将数据编码为 YAML 文档，doc 不为空时在原文档上更新，保留其中的注释和键的顺序
+func yamlDocument(v interface{}, doc *yaml.Node) (*yaml.Node, error) {
+	var value yaml.Node
+	if err := value.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %v", err)
+	}
+	if doc == nil || doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&value}}, nil
+	}
+	mergeYAMLNode(doc.Content[0], &value)
+	return doc, nil
+}
+
+// mergeYAMLNode 用 src 的内容更新 dst：已有的键保持原来的位置和注释，新增的键追加到末尾，src 中没有的键被删除
+func mergeYAMLNode(dst, src *yaml.Node) {
+	if dst.Kind != src.Kind {
+		// 类型变化时整体替换，只保留注释
+		head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+		*dst = *src
+		dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+		return
+	}
+
+	// 空的映射和列表只能使用流式写法，由空变为非空或由非空变为空时使用新的风格
+	if (dst.Kind == yaml.MappingNode || dst.Kind == yaml.SequenceNode) && (len(dst.Content) == 0 || len(src.Content) == 0) {
+		dst.Style = src.Style
+	}
+
+	switch dst.Kind {
+	case yaml.MappingNode:
+		content := make([]*yaml.Node, 0, len(src.Content))
+		used := make(map[int]bool)
+		// 按原文档中的顺序保留仍然存在的键
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			for j := 0; j+1 < len(src.Content); j += 2 {
+				if !used[j] && dst.Content[i].Value == src.Content[j].Value {
+					key, value := dst.Content[i], dst.Content[i+1]
+					mergeYAMLNode(value, src.Content[j+1])
+					// 块风格的映射和列表的行尾注释会被写到其他位置，移到键上
+					if value.Kind != yaml.ScalarNode && value.Style&yaml.FlowStyle == 0 && value.LineComment != "" && key.LineComment == "" {
+						key.LineComment, value.LineComment = value.LineComment, ""
+					}
+					content = append(content, dst.Content[i], dst.Content[i+1])
+					used[j] = true
+					break
+				}
+			}
+		}
+		for j := 0; j+1 < len(src.Content); j += 2 {
+			if !used[j] {
+				content = append(content, src.Content[j], src.Content[j+1])
+			}
+		}
+		dst.Content = content
+	case yaml.SequenceNode:
+		// 按内容匹配列表项，删除或调整顺序后注释仍跟随原来的项，无法匹配的项使用新值
+		content := make([]*yaml.Node, 0, len(src.Content))
+		used := make(map[int]bool)
+		for _, item := range src.Content {
+			i := matchSequenceItem(dst.Content, used, item)
+			if i < 0 {
+				content = append(content, item)
+				continue
+			}
+			used[i] = true
+			mergeYAMLNode(dst.Content[i], item)
+			content = append(content, dst.Content[i])
+		}
+		dst.Content = content
+	case yaml.ScalarNode:
+		// 类型不变且新值不需要引号时保留原来的引号风格
+		if dst.Tag != src.Tag || src.Style != 0 {
+			dst.Style = src.Style
+		}
+		dst.Tag, dst.Value = src.Tag, src.Value
+	default:
+		*dst = *src
+	}
+}
+
+// matchSequenceItem 在 items 中查找与 item 对应且未使用的项，找不到时返回 -1
+func matchSequenceItem(items []*yaml.Node, used map[int]bool, item *yaml.Node) int {
+	key := sequenceItemKey(item)
+	if key == "" {
+		return -1
+	}
+	for i, candidate := range items {
+		if !used[i] && sequenceItemKey(candidate) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// sequenceItemKey 列表项的标识：标量使用其值，节点使用地址、端口和用户名，其他项返回空字符串
+func sequenceItemKey(item *yaml.Node) string {
+	switch item.Kind {
+	case yaml.ScalarNode:
+		return "scalar:" + item.Value
+	case yaml.MappingNode:
+		address := mappingValue(item, "host")
+		if address == nil || address.Value == "" {
+			address = mappingValue(item, "ip")
+		}
+		username := mappingValue(item, "username")
+		if address == nil || username == nil {
+			return ""
+		}
+		port := strconv.Itoa(DefaultPort)
+		if value := mappingValue(item, "port"); value != nil && value.Value != "0" {
+			port = value.Value
+		}
+		return "node:" + address.Value + ":" + port + "@" + username.Value
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+// 两个带注释的节点
+const commentedNodes = `nodes:
+    # web server
+    - ip: 10.0.0.1
+      username: root
+      password: ""
+      tag: []
+    # prod database, do not touch
+    - ip: 10.0.0.2
+      username: postgres
+      password: ""
+      tag: [db] # primary
+`
+
+// 解析示例文件，对节点列表执行 change 后重新编码
+func rewriteNodes(t *testing.T, change func(nodes []Node) []Node) string {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(commentedNodes), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var file NodesFile
+	if err := doc.Decode(&file); err != nil {
+		t.Fatal(err)
+	}
+	file.Nodes = change(file.Nodes)
+
+	merged, err := yamlDocument(struct {
+		Nodes []Node `yaml:"nodes"`
+	}{file.Nodes}, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestYAMLDocumentKeepsCommentsAfterDelete(t *testing.T) {
+	out := rewriteNodes(t, func(nodes []Node) []Node {
+		return nodes[1:]
+	})
+
+	if strings.Contains(out, "# web server") {
+		t.Errorf("comment of the deleted node was kept:\n%s", out)
+	}
+	for _, want := range []string{"# prod database, do not touch", "# primary"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("comment %q was lost:\n%s", want, out)
+		}
+	}
+}
+
+func TestYAMLDocumentKeepsCommentsAfterReorder(t *testing.T) {
+	out := rewriteNodes(t, func(nodes []Node) []Node {
+		return []Node{nodes[1], nodes[0]}
+	})
+
+	db := strings.Index(out, "# prod database, do not touch")
+	postgres := strings.Index(out, "username: postgres")
+	web := strings.Index(out, "# web server")
+	root := strings.Index(out, "username: root")
+	if db < 0 || web < 0 || !(db < postgres && postgres < web && web < root) {
+		t.Fatalf("comments did not follow their nodes:\n%s", out)
+	}
+}
@@ -5,8 +5,10 @@ go 1.21.13
 // 直接依赖
 require (
 	github.com/creack/pty v1.1.24
+	github.com/pkg/sftp v1.13.7
 	github.com/spf13/cobra v1.8.1
 	golang.org/x/crypto v0.29.0
+	golang.org/x/net v0.31.0
 	golang.org/x/term v0.26.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -14,6 +16,7 @@ require (
 // 间接依赖
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/sys v0.27.0 // indirect
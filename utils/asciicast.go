@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// CastHeader asciicast v2 文件头
+type CastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// CastEvent asciicast v2 事件，Type 为 o（输出）、i（输入）或 r（窗口大小变化）
+type CastEvent struct {
+	Time float64
+	Type string
+	Data string
+}
+
+// CastRecorder 将终端会话写入 asciicast v2 文件，可以被多个协程同时使用
+type CastRecorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	start time.Time
+	err   error
+}
+
+// NewCastRecorder 创建录制文件并写入文件头
+func NewCastRecorder(path string, header CastHeader) (*CastRecorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Version = 2
+	r := &CastRecorder{file: file, start: time.Now()}
+	if header.Timestamp == 0 {
+		header.Timestamp = r.start.Unix()
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(file, "%s\n", data); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Output 返回记录输出事件的 Writer
+func (r *CastRecorder) Output() io.Writer {
+	return &castStream{recorder: r, eventType: "o"}
+}
+
+// Input 返回记录输入事件的 Writer
+func (r *CastRecorder) Input() io.Writer {
+	return &castStream{recorder: r, eventType: "i"}
+}
+
+// Resize 记录窗口大小变化
+func (r *CastRecorder) Resize(width, height int) {
+	r.writeEvent("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// Close 关闭文件，返回录制过程中的第一个错误
+func (r *CastRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+func (r *CastRecorder) writeEvent(eventType, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	event, err := json.Marshal([]interface{}{time.Since(r.start).Seconds(), eventType, data})
+	if err == nil {
+		// 每个事件立即写入文件，会话异常中断时不丢失内容
+		_, err = fmt.Fprintf(r.file, "%s\n", event)
+	}
+	r.err = err
+}
+
+// 单个方向的事件流，保留被截断的 UTF-8 字符到下一次写入
+type castStream struct {
+	recorder  *CastRecorder
+	eventType string
+	pending   []byte
+}
+
+func (s *castStream) Write(p []byte) (int, error) {
+	data := append(s.pending, p...)
+	// 找到最后一个完整字符的结尾
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	s.pending = append([]byte(nil), data[end:]...)
+	if end > 0 {
+		s.recorder.writeEvent(s.eventType, string(data[:end]))
+	}
+	return len(p), nil
+}
+
+// CastReader 逐个读取 asciicast v2 文件中的事件
+type CastReader struct {
+	reader *bufio.Reader
+	Header CastHeader
+}
+
+// NewCastReader 读取并校验文件头
+func NewCastReader(reader io.Reader) (*CastReader, error) {
+	r := &CastReader{reader: bufio.NewReader(reader)}
+	line, err := r.reader.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("failed to read asciicast header: %v", err)
+	}
+	if err := json.Unmarshal(line, &r.Header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %v", err)
+	}
+	if r.Header.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version %d", r.Header.Version)
+	}
+	return r, nil
+}
+
+// Next 读取下一个事件，文件结束时返回 io.EOF
+func (r *CastReader) Next() (CastEvent, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err == nil {
+				continue
+			}
+			return CastEvent{}, err
+		}
+
+		var fields []json.RawMessage
+		if jsonErr := json.Unmarshal(line, &fields); jsonErr != nil || len(fields) != 3 {
+			// 会话异常中断时最后一行可能不完整
+			if err != nil {
+				return CastEvent{}, io.EOF
+			}
+			return CastEvent{}, fmt.Errorf("invalid asciicast event: %s", line)
+		}
+		var event CastEvent
+		if err := json.Unmarshal(fields[0], &event.Time); err != nil {
+			return CastEvent{}, fmt.Errorf("invalid asciicast event time: %v", err)
+		}
+		if err := json.Unmarshal(fields[1], &event.Type); err != nil {
+			return CastEvent{}, fmt.Errorf("invalid asciicast event type: %v", err)
+		}
+		if err := json.Unmarshal(fields[2], &event.Data); err != nil {
+			return CastEvent{}, fmt.Errorf("invalid asciicast event data: %v", err)
+		}
+		return event, nil
+	}
+}
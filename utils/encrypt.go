@@ -1,46 +1,173 @@
 package utils
 
 import (
-	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"strings"
 )
 
+const (
+	// CipherV2Prefix v2 密文前缀（scrypt + AES-GCM）
+	CipherV2Prefix = "v2:"
+	// SaltSize 保险库盐值长度
+	SaltSize = 16
+	// 校验值明文，用于判断派生的密钥是否正确
+	verifierPlainText = "sshe-vault-verifier"
+
+	// scrypt 参数
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// ErrLegacyKeyMissing 解密旧版密文时密钥中没有旧版密钥
+var ErrLegacyKeyMissing = errors.New("the legacy key is required to decrypt old cipher text")
+
+// VaultKey 由秘钥串派生出的保险库密钥
+type VaultKey struct {
+	// 旧版 CBC 密文使用的 MD5 密钥，只在需要解密旧版密文时设置
+	legacy []byte
+	// v2 密文使用的 scrypt 派生密钥
+	aead []byte
+}
+
 // MD5 哈希生成工具函数（用于生成固定长度的密钥）
 func md5Hash(secretKey string) []byte {
 	hash := md5.Sum([]byte(secretKey))
 	return hash[:]
 }
 
-// EncryptAES AES 加密函数
-func EncryptAES(plainText []byte, secretKey string) (string, error) {
-	// 使用 MD5 生成 16 字节的密钥
-	block, err := aes.NewCipher(md5Hash(secretKey))
+// NewSalt 生成随机的保险库盐值
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	return salt, nil
+}
+
+// DeriveVaultKey 使用 scrypt 从秘钥串和保险库盐值派生密钥
+func DeriveVaultKey(secretKey string, salt []byte) (*VaultKey, error) {
+	if len(salt) == 0 {
+		return nil, errors.New("vault salt is empty")
+	}
+	key, err := scrypt.Key([]byte(secretKey), salt, scryptN, scryptR, scryptP, scryptKeyLen)
 	if err != nil {
-		return "", fmt.Errorf("error: failed to create AES cipher: %v", err)
+		return nil, fmt.Errorf("failed to derive key: %v", err)
 	}
+	return &VaultKey{aead: key}, nil
+}
 
-	// 填充明文至 AES 块大小的倍数
-	paddingText := pkcs7Padding(plainText, block.BlockSize())
+// WithLegacySecret 返回带有旧版密钥的副本，原密钥不变
+func (k *VaultKey) WithLegacySecret(secretKey string) *VaultKey {
+	return &VaultKey{legacy: md5Hash(secretKey), aead: k.aead}
+}
 
-	// 创建加密模式
-	cipherText := make([]byte, len(paddingText))
+// HasLegacy 是否可以解密旧版密文
+func (k *VaultKey) HasLegacy() bool {
+	return k.legacy != nil
+}
 
-	iv := md5Hash(secretKey)[:aes.BlockSize]
-	mode := cipher.NewCBCEncrypter(block, iv)
-	mode.CryptBlocks(cipherText, paddingText)
+// Bytes 序列化密钥，用于在 agent 中缓存，只包含派生密钥，不包含由秘钥串直接得到的旧版密钥
+func (k *VaultKey) Bytes() []byte {
+	return append([]byte{}, k.aead...)
+}
 
-	return hex.EncodeToString(cipherText), nil
+// VaultKeyFromBytes 从序列化的数据恢复密钥
+func VaultKeyFromBytes(data []byte) (*VaultKey, error) {
+	if len(data) != scryptKeyLen {
+		return nil, errors.New("invalid vault key length")
+	}
+	return &VaultKey{aead: append([]byte{}, data...)}, nil
 }
 
-// DecryptAES AES 解密函数
-func DecryptAES(cipherHex, key string) (string, error) {
-	// 使用 MD5 生成 16 字节的密钥
-	block, err := aes.NewCipher(md5Hash(key))
+// IsLegacyCipher 判断密文是否为旧版 CBC 格式
+func IsLegacyCipher(cipherText string) bool {
+	return cipherText != "" && !strings.HasPrefix(cipherText, CipherV2Prefix)
+}
+
+// EncryptAES AES-GCM 加密函数，输出 v2 格式密文
+func EncryptAES(plainText []byte, key *VaultKey) (string, error) {
+	gcm, err := newGCM(key.aead)
+	if err != nil {
+		return "", err
+	}
+
+	// 每条记录使用随机 nonce
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plainText, nil)
+	return CipherV2Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptAES AES 解密函数，兼容 v2 格式与旧版十六进制 CBC 密文
+func DecryptAES(cipherText string, key *VaultKey) (string, error) {
+	if !strings.HasPrefix(cipherText, CipherV2Prefix) {
+		if key.legacy == nil {
+			return "", ErrLegacyKeyMissing
+		}
+		return decryptLegacyCBC(cipherText, key.legacy)
+	}
+
+	gcm, err := newGCM(key.aead)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(cipherText, CipherV2Prefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode cipher text: %v", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid cipher text length")
+	}
+
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plainText, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt cipher text: wrong key or data has been tampered with")
+	}
+	return string(plainText), nil
+}
+
+// NewVerifier 生成密钥校验值
+func NewVerifier(key *VaultKey) (string, error) {
+	return EncryptAES([]byte(verifierPlainText), key)
+}
+
+// CheckVerifier 校验密钥是否与保险库匹配
+func CheckVerifier(verifier string, key *VaultKey) bool {
+	plainText, err := DecryptAES(verifier, key)
+	return err == nil && plainText == verifierPlainText
+}
+
+// 创建 AES-GCM 加密器
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM cipher: %v", err)
+	}
+	return gcm, nil
+}
+
+// 旧版 CBC 解密（密钥和 IV 均由 MD5 生成），仅用于读取历史数据
+func decryptLegacyCBC(cipherHex string, key []byte) (string, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", fmt.Errorf("failed to create AES cipher: %v", err)
 	}
@@ -52,13 +179,13 @@ func DecryptAES(cipherHex, key string) (string, error) {
 	}
 
 	// 验证密文长度是否合法
-	if len(cipherText)%block.BlockSize() != 0 {
+	if len(cipherText) == 0 || len(cipherText)%block.BlockSize() != 0 {
 		return "", errors.New("invalid cipher text length")
 	}
 
 	// 创建解密模式
 	plainText := make([]byte, len(cipherText))
-	iv := md5Hash(key)[:aes.BlockSize] // 使用 key 的前 16 字节作为 IV
+	iv := key[:aes.BlockSize] // 使用 key 的前 16 字节作为 IV
 	mode := cipher.NewCBCDecrypter(block, iv)
 	mode.CryptBlocks(plainText, cipherText)
 
@@ -71,13 +198,6 @@ func DecryptAES(cipherHex, key string) (string, error) {
 	return string(plainText), nil
 }
 
-// PKCS7 填充
-func pkcs7Padding(data []byte, blockSize int) []byte {
-	padding := blockSize - len(data)%blockSize
-	padText := bytes.Repeat([]byte{byte(padding)}, padding)
-	return append(data, padText...)
-}
-
 // PKCS7 去除填充
 func pkcs7UnPadding(data []byte) ([]byte, error) {
 	length := len(data)
@@ -86,7 +206,7 @@ func pkcs7UnPadding(data []byte) ([]byte, error) {
 	}
 
 	padding := int(data[length-1])
-	if padding > length || padding > aes.BlockSize {
+	if padding == 0 || padding > length || padding > aes.BlockSize {
 		return nil, errors.New("invalid padding")
 	}
 
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 旧版 sshe 使用默认秘钥串 sshe2024 加密的密文
+const (
+	legacySecretKey     = "sshe2024"
+	legacyCipherText    = "d62a8aff30e68e0e08e48464dc9851ff" // s3cret-pw
+	legacyEmptyPassword = "4acd68cfdb59fbb4ca10acd5950360cb" // 空密码
+	legacyPlainText     = "s3cret-pw"
+	testSecretKey       = "test-secret"
+	otherSecretKey      = "other-secret"
+	testSalt            = "0123456789abcdef"
+)
+
+// 使用固定的盐值派生测试密钥
+func testVaultKey(t *testing.T, secretKey, salt string) *VaultKey {
+	t.Helper()
+	key, err := DeriveVaultKey(secretKey, []byte(salt))
+	if err != nil {
+		t.Fatalf("DeriveVaultKey: %v", err)
+	}
+	return key
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	key := testVaultKey(t, testSecretKey, testSalt)
+	for _, plainText := range []string{"", "password", strings.Repeat("长", 100)} {
+		cipherText, err := EncryptAES([]byte(plainText), key)
+		if err != nil {
+			t.Fatalf("EncryptAES: %v", err)
+		}
+		if !strings.HasPrefix(cipherText, CipherV2Prefix) || IsLegacyCipher(cipherText) {
+			t.Fatalf("cipher text %q is not in v2 format", cipherText)
+		}
+		got, err := DecryptAES(cipherText, key)
+		if err != nil {
+			t.Fatalf("DecryptAES: %v", err)
+		}
+		if got != plainText {
+			t.Fatalf("got %q, want %q", got, plainText)
+		}
+	}
+}
+
+func TestEncryptUsesUniqueNonces(t *testing.T) {
+	key := testVaultKey(t, testSecretKey, testSalt)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		cipherText, err := EncryptAES([]byte("password"), key)
+		if err != nil {
+			t.Fatalf("EncryptAES: %v", err)
+		}
+		if seen[cipherText] {
+			t.Fatalf("cipher text %q was produced twice", cipherText)
+		}
+		seen[cipherText] = true
+	}
+}
+
+func TestDecryptLegacyCipherText(t *testing.T) {
+	key := testVaultKey(t, legacySecretKey, testSalt).WithLegacySecret(legacySecretKey)
+	tests := map[string]string{
+		legacyCipherText:    legacyPlainText,
+		legacyEmptyPassword: "",
+	}
+	for cipherText, want := range tests {
+		if !IsLegacyCipher(cipherText) {
+			t.Fatalf("%s should be a legacy cipher text", cipherText)
+		}
+		got, err := DecryptAES(cipherText, key)
+		if err != nil {
+			t.Fatalf("DecryptAES(%s): %v", cipherText, err)
+		}
+		if got != want {
+			t.Fatalf("DecryptAES(%s) = %q, want %q", cipherText, got, want)
+		}
+	}
+}
+
+func TestDecryptLegacyRequiresLegacyKey(t *testing.T) {
+	key := testVaultKey(t, legacySecretKey, testSalt)
+	if key.HasLegacy() {
+		t.Fatal("derived key should not carry the legacy key")
+	}
+	if _, err := DecryptAES(legacyCipherText, key); !errors.Is(err, ErrLegacyKeyMissing) {
+		t.Fatalf("got %v, want ErrLegacyKeyMissing", err)
+	}
+}
+
+func TestDecryptDetectsTampering(t *testing.T) {
+	key := testVaultKey(t, testSecretKey, testSalt)
+	cipherText, err := EncryptAES([]byte("password"), key)
+	if err != nil {
+		t.Fatalf("EncryptAES: %v", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(cipherText, CipherV2Prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	tampered := CipherV2Prefix + base64.StdEncoding.EncodeToString(sealed)
+	if _, err := DecryptAES(tampered, key); err == nil {
+		t.Fatal("tampered cipher text was accepted")
+	}
+
+	other := testVaultKey(t, otherSecretKey, testSalt)
+	if _, err := DecryptAES(cipherText, other); err == nil {
+		t.Fatal("cipher text was decrypted with the wrong key")
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	key := testVaultKey(t, testSecretKey, testSalt)
+	verifier, err := NewVerifier(key)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	if !CheckVerifier(verifier, key) {
+		t.Fatal("verifier rejected the right key")
+	}
+	if CheckVerifier(verifier, testVaultKey(t, otherSecretKey, testSalt)) {
+		t.Fatal("verifier accepted a key derived from another secret")
+	}
+	if CheckVerifier(verifier, testVaultKey(t, testSecretKey, "fedcba9876543210")) {
+		t.Fatal("verifier accepted a key derived with another salt")
+	}
+}
+
+func TestVaultKeyBytesExcludeLegacyKey(t *testing.T) {
+	key := testVaultKey(t, legacySecretKey, testSalt).WithLegacySecret(legacySecretKey)
+	restored, err := VaultKeyFromBytes(key.Bytes())
+	if err != nil {
+		t.Fatalf("VaultKeyFromBytes: %v", err)
+	}
+	if restored.HasLegacy() {
+		t.Fatal("serialized key carries the legacy key")
+	}
+	if !bytes.Equal(restored.aead, key.aead) {
+		t.Fatal("serialized key lost the derived key")
+	}
+}
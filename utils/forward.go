@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ForwardBindAddress 未指定监听地址时只监听本机回环地址
+const ForwardBindAddress = "127.0.0.1"
+
+// ParseForwardSpec 解析 [bind:]port:host:hostport 格式的端口转发，返回监听地址和目标地址
+func ParseForwardSpec(spec string) (string, string, error) {
+	fields, err := splitForwardSpec(spec)
+	if err != nil {
+		return "", "", err
+	}
+	bind := ForwardBindAddress
+	switch len(fields) {
+	case 3:
+	case 4:
+		bind, fields = fields[0], fields[1:]
+	default:
+		return "", "", fmt.Errorf("invalid forward %s, the format is [bind:]port:host:hostport", spec)
+	}
+
+	listen, err := joinForwardAddress(bind, fields[0], true)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid forward %s: %v", spec, err)
+	}
+	target, err := joinForwardAddress(fields[1], fields[2], false)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid forward %s: %v", spec, err)
+	}
+	return listen, target, nil
+}
+
+// ParseDynamicForwardSpec 解析 [bind:]port 格式的动态转发，返回监听地址
+func ParseDynamicForwardSpec(spec string) (string, error) {
+	fields, err := splitForwardSpec(spec)
+	if err != nil {
+		return "", err
+	}
+	bind := ForwardBindAddress
+	switch len(fields) {
+	case 1:
+	case 2:
+		bind, fields = fields[0], fields[1:]
+	default:
+		return "", fmt.Errorf("invalid dynamic forward %s, the format is [bind:]port", spec)
+	}
+
+	listen, err := joinForwardAddress(bind, fields[0], true)
+	if err != nil {
+		return "", fmt.Errorf("invalid dynamic forward %s: %v", spec, err)
+	}
+	return listen, nil
+}
+
+// 按冒号拆分转发参数，方括号中的 IPv6 地址不拆分
+func splitForwardSpec(spec string) ([]string, error) {
+	var fields []string
+	for spec != "" {
+		if strings.HasPrefix(spec, "[") {
+			end := strings.Index(spec, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("%s is missing ']'", spec)
+			}
+			fields = append(fields, spec[1:end])
+			spec = spec[end+1:]
+			if spec != "" && !strings.HasPrefix(spec, ":") {
+				return nil, fmt.Errorf("invalid forward %s", spec)
+			}
+			spec = strings.TrimPrefix(spec, ":")
+			continue
+		}
+		field, rest, found := strings.Cut(spec, ":")
+		fields = append(fields, field)
+		spec = rest
+		if found && rest == "" {
+			fields = append(fields, "")
+		}
+	}
+	return fields, nil
+}
+
+// 组合主机和端口，监听端口允许为 0 表示由系统分配
+func joinForwardAddress(host, portStr string, listen bool) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("host cannot be empty")
+	}
+	if listen && host == "*" {
+		// 监听所有地址
+		host = "0.0.0.0"
+	} else if err := AssertHostValid(host); err != nil {
+		return "", err
+	}
+
+	minPort := 1
+	if listen {
+		minPort = 0
+	}
+	port, err := parsePort(portStr, minPort)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// Pipe 在两个连接之间双向转发数据，两个方向都结束后关闭连接
+func Pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		// 尽量只关闭写方向，让另一方向的数据继续传输
+		if closer, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = closer.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+	_ = a.Close()
+	_ = b.Close()
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec   string
+		listen string
+		target string
+	}{
+		{"8080:localhost:80", "127.0.0.1:8080", "localhost:80"},
+		{"0.0.0.0:8080:10.0.0.2:80", "0.0.0.0:8080", "10.0.0.2:80"},
+		{"*:8080:db:5432", "0.0.0.0:8080", "db:5432"},
+		{"[::1]:8080:[2001:db8::1]:80", "[::1]:8080", "[2001:db8::1]:80"},
+		{"0:localhost:80", "127.0.0.1:0", "localhost:80"},
+	}
+	for _, tt := range tests {
+		listen, target, err := ParseForwardSpec(tt.spec)
+		if err != nil {
+			t.Errorf("ParseForwardSpec(%q): %v", tt.spec, err)
+			continue
+		}
+		if listen != tt.listen || target != tt.target {
+			t.Errorf("ParseForwardSpec(%q) = %q, %q, want %q, %q", tt.spec, listen, target, tt.listen, tt.target)
+		}
+	}
+}
+
+func TestParseForwardSpecRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"8080:localhost",
+		"8080:localhost:",
+		"8080:localhost:0",
+		"8080::80",
+		":8080:localhost:80",
+		"8080:localhost:+80",
+		"70000:localhost:80",
+		"a:b:c:d:e",
+		"[::1:8080:localhost:80",
+	} {
+		if listen, target, err := ParseForwardSpec(spec); err == nil {
+			t.Errorf("ParseForwardSpec(%q) = %q, %q, want an error", spec, listen, target)
+		}
+	}
+}
+
+func TestParseDynamicForwardSpec(t *testing.T) {
+	tests := map[string]string{
+		"1080":        "127.0.0.1:1080",
+		"*:1080":      "0.0.0.0:1080",
+		"[::1]:1080":  "[::1]:1080",
+		"0.0.0.0:0":   "0.0.0.0:0",
+		"localhost:1": "localhost:1",
+	}
+	for spec, want := range tests {
+		listen, err := ParseDynamicForwardSpec(spec)
+		if err != nil {
+			t.Errorf("ParseDynamicForwardSpec(%q): %v", spec, err)
+			continue
+		}
+		if listen != want {
+			t.Errorf("ParseDynamicForwardSpec(%q) = %q, want %q", spec, listen, want)
+		}
+	}
+
+	for _, spec := range []string{"", "1080:", ":1080", "a:b:1080", "-1"} {
+		if listen, err := ParseDynamicForwardSpec(spec); err == nil {
+			t.Errorf("ParseDynamicForwardSpec(%q) = %q, want an error", spec, listen)
+		}
+	}
+}
+
+func TestSplitForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec   string
+		fields []string
+	}{
+		{"8080:localhost:80", []string{"8080", "localhost", "80"}},
+		{"[::1]:8080", []string{"::1", "8080"}},
+		{"8080:[2001:db8::1]:80", []string{"8080", "2001:db8::1", "80"}},
+		{"8080:", []string{"8080", ""}},
+		{":8080", []string{"", "8080"}},
+	}
+	for _, tt := range tests {
+		fields, err := splitForwardSpec(tt.spec)
+		if err != nil {
+			t.Errorf("splitForwardSpec(%q): %v", tt.spec, err)
+			continue
+		}
+		if !slices.Equal(fields, tt.fields) {
+			t.Errorf("splitForwardSpec(%q) = %q, want %q", tt.spec, fields, tt.fields)
+		}
+	}
+
+	for _, spec := range []string{"[::1", "[::1]8080"} {
+		if fields, err := splitForwardSpec(spec); err == nil {
+			t.Errorf("splitForwardSpec(%q) = %q, want an error", spec, fields)
+		}
+	}
+}
@@ -3,15 +3,90 @@ package utils
 import (
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 )
 
-func AssertIpAddressValid(ip string) error {
-	if ip == "" {
-		return fmt.Errorf("IP cannot be empty")
+// AssertHostValid 校验主机地址是否为合法的 IP 或域名
+func AssertHostValid(host string) error {
+	if host == "" {
+		return fmt.Errorf("host cannot be empty")
 	}
-	if net.ParseIP(ip) == nil {
-		return fmt.Errorf("%s is an invalid IP address", ip)
+	if net.ParseIP(host) != nil {
+		return nil
 	}
 
+	if len(host) > 253 {
+		return fmt.Errorf("%s is an invalid hostname", host)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%s is an invalid hostname", host)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("%s is an invalid hostname", host)
+			}
+		}
+	}
 	return nil
 }
+
+// ParseHostPort 解析 host、host:port、IPv6 以及 [IPv6]:port 格式的地址，未指定端口时返回 0
+func ParseHostPort(address string) (string, int, error) {
+	host, portStr, hasPort := address, "", false
+	switch {
+	case strings.HasPrefix(address, "["):
+		// [IPv6] 或 [IPv6]:port
+		end := strings.Index(address, "]")
+		if end < 0 {
+			return "", 0, fmt.Errorf("%s is missing ']' in address", address)
+		}
+		host = address[1:end]
+		rest := address[end+1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return "", 0, fmt.Errorf("%s is an invalid address", address)
+			}
+			portStr, hasPort = rest[1:], true
+		}
+		if net.ParseIP(host) == nil || !strings.Contains(host, ":") {
+			return "", 0, fmt.Errorf("%s is an invalid IPv6 address", host)
+		}
+	case net.ParseIP(address) != nil:
+		// 不带端口的 IPv4 或 IPv6
+	case strings.Count(address, ":") == 1:
+		host, portStr, hasPort = strings.Cut(address, ":")
+	case strings.Count(address, ":") > 1:
+		return "", 0, fmt.Errorf("%s is an invalid address, use [IPv6]:port to specify a port", address)
+	}
+
+	if err := AssertHostValid(host); err != nil {
+		return "", 0, err
+	}
+	if !hasPort {
+		return host, 0, nil
+	}
+	port, err := parsePort(portStr, 1)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, port, nil
+}
+
+// parsePort 解析端口号，只接受十进制数字，范围为 minPort 到 65535
+func parsePort(portStr string, minPort int) (int, error) {
+	if portStr == "" {
+		return 0, fmt.Errorf("port cannot be empty")
+	}
+	for _, c := range portStr {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%s is an invalid port", portStr)
+		}
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < minPort || port > 65535 {
+		return 0, fmt.Errorf("%s is an invalid port", portStr)
+	}
+	return port, nil
+}
@@ -0,0 +1,51 @@
+package utils
+
+import "testing"
+
+func TestParseHostPort(t *testing.T) {
+	tests := []struct {
+		address string
+		host    string
+		port    int
+	}{
+		{"10.0.0.1", "10.0.0.1", 0},
+		{"10.0.0.1:2222", "10.0.0.1", 2222},
+		{"example.com", "example.com", 0},
+		{"example.com:22", "example.com", 22},
+		{"::1", "::1", 0},
+		{"[::1]", "::1", 0},
+		{"[2001:db8::1]:2222", "2001:db8::1", 2222},
+	}
+	for _, tt := range tests {
+		host, port, err := ParseHostPort(tt.address)
+		if err != nil {
+			t.Errorf("ParseHostPort(%q): %v", tt.address, err)
+			continue
+		}
+		if host != tt.host || port != tt.port {
+			t.Errorf("ParseHostPort(%q) = %q, %d, want %q, %d", tt.address, host, port, tt.host, tt.port)
+		}
+	}
+}
+
+func TestParseHostPortRejectsInvalidAddresses(t *testing.T) {
+	for _, address := range []string{
+		"",
+		"example.com:",
+		"[::1]:",
+		"example.com:0",
+		"example.com:65536",
+		"example.com:+22",
+		"example.com:22a",
+		"[::1",
+		"[::1]22",
+		"[10.0.0.1]:22",
+		"bad_host",
+		"-example.com",
+		"a:b:c",
+	} {
+		if host, port, err := ParseHostPort(address); err == nil {
+			t.Errorf("ParseHostPort(%q) = %q, %d, want an error", address, host, port)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/net/proxy"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ParseProxyURL 解析并校验代理地址，支持 socks5://、socks5h:// 和 http://
+func ParseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %s: %v", rawURL, err)
+	}
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, must be socks5 or http", proxyURL.Scheme)
+	}
+	if proxyURL.Hostname() == "" || proxyURL.Port() == "" {
+		return nil, fmt.Errorf("invalid proxy URL %s, host and port are required", rawURL)
+	}
+	return proxyURL, nil
+}
+
+// NewProxyDialer 根据代理地址创建拨号器，password 为代理认证密码
+func NewProxyDialer(rawURL, password string, timeout time.Duration) (proxy.Dialer, error) {
+	proxyURL, err := ParseProxyURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	forward := &net.Dialer{Timeout: timeout}
+
+	username := proxyURL.User.Username()
+	switch proxyURL.Scheme {
+	case "http":
+		return &httpConnectDialer{
+			address:  proxyURL.Host,
+			username: username,
+			password: password,
+			forward:  forward,
+			timeout:  timeout,
+		}, nil
+	default:
+		var auth *proxy.Auth
+		if username != "" {
+			auth = &proxy.Auth{User: username, Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, forward)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SOCKS5 dialer: %v", err)
+		}
+		return dialer, nil
+	}
+}
+
+// 通过 HTTP CONNECT 建立隧道的拨号器
+type httpConnectDialer struct {
+	address  string
+	username string
+	password string
+	forward  proxy.Dialer
+	timeout  time.Duration
+}
+
+// Dial 连接代理并请求建立到目标地址的隧道
+func (d *httpConnectDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.forward.Dial(network, d.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %v", d.address, err)
+	}
+	if d.timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(d.timeout))
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if d.username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(d.username + ":" + d.password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT request: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused to connect to %s: %s", address, resp.Status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	// 服务端可能在响应后立即发送数据，需要保留已缓冲的部分
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// 优先读取已缓冲数据的连接
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
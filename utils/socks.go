@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	socks5Version         = 0x05
+	socks5NoAuth          = 0x00
+	socks5NoAcceptable    = 0xff
+	socks5Connect         = 0x01
+	socks5AddrIPv4        = 0x01
+	socks5AddrDomain      = 0x03
+	socks5AddrIPv6        = 0x04
+	socks5Succeeded       = 0x00
+	socks5HostFailure     = 0x04
+	socks5CmdUnsupported  = 0x07
+	socks5AddrUnsupported = 0x08
+)
+
+// SOCKS5Handshake 作为 SOCKS5 服务端完成握手，通过 dial 连接客户端请求的目标地址并返回该连接
+func SOCKS5Handshake(conn net.Conn, dial func(network, address string) (net.Conn, error)) (net.Conn, error) {
+	// 协商认证方式，只支持无认证
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, fmt.Errorf("failed to read SOCKS greeting: %v", err)
+	}
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, fmt.Errorf("failed to read SOCKS auth methods: %v", err)
+	}
+	method := byte(socks5NoAcceptable)
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			method = socks5NoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return nil, err
+	}
+	if method == socks5NoAcceptable {
+		return nil, errors.New("SOCKS client does not support no-auth")
+	}
+
+	// 读取请求
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, fmt.Errorf("failed to read SOCKS request: %v", err)
+	}
+	host, err := readSOCKS5Address(conn, request[3])
+	if err != nil {
+		_ = writeSOCKS5Reply(conn, socks5AddrUnsupported)
+		return nil, err
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return nil, fmt.Errorf("failed to read SOCKS request: %v", err)
+	}
+	if request[1] != socks5Connect {
+		_ = writeSOCKS5Reply(conn, socks5CmdUnsupported)
+		return nil, fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+	target, err := dial("tcp", address)
+	if err != nil {
+		_ = writeSOCKS5Reply(conn, socks5HostFailure)
+		return nil, fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	if err := writeSOCKS5Reply(conn, socks5Succeeded); err != nil {
+		_ = target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+// 读取 SOCKS5 请求中的目标地址
+func readSOCKS5Address(conn net.Conn, addrType byte) (string, error) {
+	switch addrType {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		size := net.IPv4len
+		if addrType == socks5AddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make(net.IP, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", fmt.Errorf("failed to read SOCKS address: %v", err)
+		}
+		return ip.String(), nil
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", fmt.Errorf("failed to read SOCKS address: %v", err)
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", fmt.Errorf("failed to read SOCKS address: %v", err)
+		}
+		return string(domain), nil
+	default:
+		return "", fmt.Errorf("unsupported SOCKS address type %d", addrType)
+	}
+}
+
+// 回复 SOCKS5 请求结果，绑定地址固定为 0.0.0.0:0
+func writeSOCKS5Reply(conn net.Conn, status byte) error {
+	_, err := conn.Write([]byte{socks5Version, status, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}